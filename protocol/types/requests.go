@@ -138,6 +138,11 @@ type Connect struct {
 	FirewallOnDuringConnection bool
 
 	WireGuardParameters struct {
+		// Port.Port == 0 requests automatic selection of a free listen port in the
+		// daemon-configured range (also used for the "random port each session" UI
+		// preference - just always send 0). If a specific port is requested but is
+		// already in use, the daemon rolls forward to the next free port. The effective
+		// port is not included in VPN state notifications or the connect response.
 		Port struct {
 			Port int
 		}
@@ -219,6 +224,36 @@ type WiFiCurrentNetwork struct {
 	CommandBase
 }
 
+// WiFiAvailableNetworksDetailed - get rich scan results (BSSID, RSSI, security,
+// frequency) for currently visible WIFI networks
+type WiFiAvailableNetworksDetailed struct {
+	CommandBase
+}
+
+// WiFiPolicyRule describes a single trusted-network rule, as used by SetWiFiPolicy.
+type WiFiPolicyRule struct {
+	SSID    string // exact SSID to match; empty means "use Kind instead"
+	Kind    string // catch-all matcher when SSID=="": "open" | "wep" | "unknown"
+	Actions []string
+}
+
+// SetWiFiPolicy replaces the daemon's persistent trusted-network policy table
+type SetWiFiPolicy struct {
+	CommandBase
+	Rules []WiFiPolicyRule
+}
+
+// GetWiFiPolicy requests the daemon's current trusted-network policy table
+type GetWiFiPolicy struct {
+	CommandBase
+}
+
+// Metrics requests a snapshot of the daemon's internal counters/gauges
+// (connects, DNS change latency, firewall rule churn, handshake age, ...)
+type Metrics struct {
+	CommandBase
+}
+
 // APIRequest do custom request to API
 type APIRequest struct {
 	CommandBase
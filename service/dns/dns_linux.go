@@ -0,0 +1,127 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ivpn/desktop-app-daemon/service/metrics"
+)
+
+// backend abstracts the mechanism used to point DNS resolution at the VPN interface.
+// Linux has several competing ways to do this depending on what is managing
+// /etc/resolv.conf on the host, so implSetManual/implDeleteManual pick one at
+// implInitialize() time rather than hard-coding a single approach.
+type backend interface {
+	name() string
+	setManual(addr net.IP, localInterfaceIP net.IP) error
+	deleteManual(localInterfaceIP net.IP) error
+	pause() error
+	resume(defaultDNS net.IP) error
+}
+
+var (
+	backendMutex  sync.Mutex
+	activeBackend backend
+)
+
+// implInitialize detects which DNS mechanism is in control of this system and selects
+// the most specific backend available: systemd-resolved (preferred, if running), then
+// resolvconf, falling back to directly rewriting /etc/resolv.conf.
+func implInitialize() error {
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+
+	if isResolvedActive() {
+		log.Info("DNS: using systemd-resolved backend")
+		activeBackend = newResolvedBackend()
+		return nil
+	}
+
+	if isResolvconfAvailable() {
+		log.Info("DNS: using resolvconf backend")
+		activeBackend = &resolvconfBackend{}
+		return nil
+	}
+
+	log.Info("DNS: using direct /etc/resolv.conf rewrite backend")
+	activeBackend = &fileBackend{}
+	return nil
+}
+
+func implPause() error {
+	backendMutex.Lock()
+	b := activeBackend
+	backendMutex.Unlock()
+
+	if b == nil {
+		return nil
+	}
+	return b.pause()
+}
+
+func implResume(defaultDNS net.IP) error {
+	backendMutex.Lock()
+	b := activeBackend
+	backendMutex.Unlock()
+
+	if b == nil {
+		return nil
+	}
+	return b.resume(defaultDNS)
+}
+
+func implSetManual(addr net.IP, localInterfaceIP net.IP) error {
+	backendMutex.Lock()
+	b := activeBackend
+	backendMutex.Unlock()
+
+	if b == nil {
+		return fmt.Errorf("DNS backend not initialized")
+	}
+
+	start := time.Now()
+	err := b.setManual(addr, localInterfaceIP)
+	metrics.DNSLatency.Observe(time.Since(start))
+	metrics.DNSSetCount.Inc()
+	return err
+}
+
+func implDeleteManual(localInterfaceIP net.IP) error {
+	backendMutex.Lock()
+	b := activeBackend
+	backendMutex.Unlock()
+
+	if b == nil {
+		return nil
+	}
+
+	start := time.Now()
+	err := b.deleteManual(localInterfaceIP)
+	metrics.DNSLatency.Observe(time.Since(start))
+	metrics.DNSDeleteCount.Inc()
+	return err
+}
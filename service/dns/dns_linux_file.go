@@ -0,0 +1,89 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const resolvConfPath = "/etc/resolv.conf"
+const resolvConfBackupPath = "/etc/resolv.conf.ivpnsave"
+
+// fileBackend is the lowest-common-denominator backend: it directly overwrites
+// /etc/resolv.conf. It is only selected when neither systemd-resolved nor
+// resolvconf is managing DNS on the host.
+type fileBackend struct{}
+
+func isResolvconfAvailable() bool {
+	_, err := exec.LookPath("resolvconf")
+	return err == nil
+}
+
+// resolvconfBackend feeds DNS configuration through the 'resolvconf' utility,
+// which merges it into /etc/resolv.conf alongside whatever else manages it.
+type resolvconfBackend struct{}
+
+func (b *resolvconfBackend) name() string { return "resolvconf" }
+
+func (b *resolvconfBackend) setManual(addr net.IP, localInterfaceIP net.IP) error {
+	cmd := exec.Command("resolvconf", "-a", "ivpn")
+	cmd.Stdin = strings.NewReader("nameserver " + addr.String() + "\n")
+	return cmd.Run()
+}
+
+func (b *resolvconfBackend) deleteManual(localInterfaceIP net.IP) error {
+	cmd := exec.Command("resolvconf", "-d", "ivpn")
+	return cmd.Run()
+}
+
+func (b *resolvconfBackend) pause() error                  { return nil }
+func (b *resolvconfBackend) resume(defaultDNS net.IP) error { return nil }
+
+func (b *fileBackend) name() string { return "resolv.conf" }
+
+func (b *fileBackend) setManual(addr net.IP, localInterfaceIP net.IP) error {
+	if _, err := os.Stat(resolvConfBackupPath); err != nil {
+		// first time - keep a copy of the original so we can restore it on deleteManual
+		data, err := ioutil.ReadFile(resolvConfPath)
+		if err == nil {
+			ioutil.WriteFile(resolvConfBackupPath, data, 0644)
+		}
+	}
+	return ioutil.WriteFile(resolvConfPath, []byte("nameserver "+addr.String()+"\n"), 0644)
+}
+
+func (b *fileBackend) deleteManual(localInterfaceIP net.IP) error {
+	data, err := ioutil.ReadFile(resolvConfBackupPath)
+	if err != nil {
+		return nil
+	}
+	defer os.Remove(resolvConfBackupPath)
+	return ioutil.WriteFile(resolvConfPath, data, 0644)
+}
+
+func (b *fileBackend) pause() error                  { return nil }
+func (b *fileBackend) resume(defaultDNS net.IP) error { return nil }
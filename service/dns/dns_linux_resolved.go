@@ -0,0 +1,180 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/ivpn/desktop-app-daemon/netinfo"
+)
+
+const (
+	resolvedDest          = "org.freedesktop.resolve1"
+	resolvedPath          = "/org/freedesktop/resolve1"
+	resolvedManagerIface  = "org.freedesktop.resolve1.Manager"
+	resolvedStubResolv    = "/run/systemd/resolve/stub-resolv.conf"
+	resolvedRoutingDomain = "~."
+)
+
+// isResolvedActive detects whether systemd-resolved is the active resolver on this host:
+// either /etc/resolv.conf is (a symlink to) the resolved stub file, or the resolve1 manager
+// answers on the system bus.
+func isResolvedActive() bool {
+	if target, err := os.Readlink(resolvConfPath); err == nil {
+		if target == resolvedStubResolv || target == "/run/systemd/resolve/resolv.conf" {
+			return true
+		}
+	}
+
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return false
+	}
+	obj := conn.Object(resolvedDest, dbus.ObjectPath(resolvedPath))
+	if call := obj.Call("org.freedesktop.DBus.Peer.Ping", 0); call.Err != nil {
+		return false
+	}
+	return true
+}
+
+// resolvedLinkDNS matches the (family, address) pairs used by SetLinkDNS over D-Bus
+type resolvedLinkDNS struct {
+	Family  int32
+	Address []byte
+}
+
+// resolvedLinkDomain matches the (domain, routeOnly) pairs used by SetLinkDomains
+type resolvedLinkDomain struct {
+	Domain    string
+	RouteOnly bool
+}
+
+// resolvedBackend drives systemd-resolved over D-Bus (org.freedesktop.resolve1.Manager),
+// claiming the VPN link as the routing-only ("~.") DNS server for all queries.
+type resolvedBackend struct {
+	conn *dbus.Conn
+
+	// lastInterfaceIP is the VPN-local IP passed to the most recent setManual call,
+	// kept around so pause()/resume() can resolve the same link index without the
+	// backend interface having to thread it through their own signatures.
+	lastInterfaceIP net.IP
+}
+
+func newResolvedBackend() *resolvedBackend {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		log.Error("failed to connect to system D-Bus: ", err)
+	}
+	return &resolvedBackend{conn: conn}
+}
+
+func (b *resolvedBackend) name() string { return "systemd-resolved" }
+
+func (b *resolvedBackend) manager() dbus.BusObject {
+	return b.conn.Object(resolvedDest, dbus.ObjectPath(resolvedPath))
+}
+
+func (b *resolvedBackend) setManual(addr net.IP, localInterfaceIP net.IP) error {
+	if b.conn == nil {
+		return fmt.Errorf("systemd-resolved: no D-Bus connection")
+	}
+
+	ifIndex, err := vpnLinkIndex(localInterfaceIP)
+	if err != nil {
+		return fmt.Errorf("systemd-resolved: %w", err)
+	}
+
+	dnsEntry := toResolvedDNS(addr)
+	manager := b.manager()
+
+	if call := manager.Call(resolvedManagerIface+".SetLinkDNS", 0, ifIndex, []resolvedLinkDNS{dnsEntry}); call.Err != nil {
+		return fmt.Errorf("SetLinkDNS failed: %w", call.Err)
+	}
+
+	domains := []resolvedLinkDomain{{Domain: resolvedRoutingDomain, RouteOnly: true}}
+	if call := manager.Call(resolvedManagerIface+".SetLinkDomains", 0, ifIndex, domains); call.Err != nil {
+		return fmt.Errorf("SetLinkDomains failed: %w", call.Err)
+	}
+
+	if call := manager.Call(resolvedManagerIface+".SetLinkDNSOverTLS", 0, ifIndex, ""); call.Err != nil {
+		log.Warning("SetLinkDNSOverTLS failed: ", call.Err)
+	}
+
+	if call := manager.Call(resolvedManagerIface+".SetLinkDefaultRoute", 0, ifIndex, true); call.Err != nil {
+		return fmt.Errorf("SetLinkDefaultRoute failed: %w", call.Err)
+	}
+
+	b.lastInterfaceIP = localInterfaceIP
+	return nil
+}
+
+func (b *resolvedBackend) deleteManual(localInterfaceIP net.IP) error {
+	if b.conn == nil {
+		return nil
+	}
+	ifIndex, err := vpnLinkIndex(localInterfaceIP)
+	if err != nil {
+		// interface is already gone - nothing to revert
+		return nil
+	}
+	call := b.manager().Call(resolvedManagerIface+".RevertLink", 0, ifIndex)
+	return call.Err
+}
+
+// pause/resume: RevertLink the VPN link's DNS settings while paused, re-apply on resume.
+// The non-VPN NIC is never touched by this backend.
+func (b *resolvedBackend) pause() error {
+	return b.deleteManual(b.lastInterfaceIP)
+}
+
+func (b *resolvedBackend) resume(defaultDNS net.IP) error {
+	if b.lastInterfaceIP == nil {
+		return fmt.Errorf("systemd-resolved: no paused VPN link to resume DNS on")
+	}
+	return b.setManual(defaultDNS, b.lastInterfaceIP)
+}
+
+func toResolvedDNS(addr net.IP) resolvedLinkDNS {
+	if ip4 := addr.To4(); ip4 != nil {
+		return resolvedLinkDNS{Family: 2 /* AF_INET */, Address: []byte(ip4)}
+	}
+	return resolvedLinkDNS{Family: 10 /* AF_INET6 */, Address: []byte(addr.To16())}
+}
+
+func vpnLinkIndex(localInterfaceIP net.IP) (int32, error) {
+	if localInterfaceIP == nil {
+		return 0, fmt.Errorf("no VPN-local IP to resolve link index from")
+	}
+	ifc, err := netinfo.InterfaceByIPAddr(localInterfaceIP)
+	if err != nil {
+		return 0, err
+	}
+	if ifc == nil {
+		return 0, fmt.Errorf("no interface found for %s", localInterfaceIP)
+	}
+	return int32(ifc.Index), nil
+}
@@ -0,0 +1,100 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// StartScrapeServer starts a loopback-only HTTP server rendering current metrics in
+// Prometheus text exposition format at '/metrics'. Requests must present the daemon
+// secret as a bearer token ('Authorization: Bearer <secret>'); anything else gets 403.
+// Intended for operators running the daemon unattended (bastion/self-hosted scenario)
+// who want to scrape it rather than poll the RPC 'Metrics' request.
+func StartScrapeServer(listenAddr string, secret uint64) (stop func() error, err error) {
+	addr, err := net.ResolveTCPAddr("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metrics scrape address: %w", err)
+	}
+	if addr.IP == nil || !addr.IP.IsLoopback() {
+		return nil, fmt.Errorf("metrics scrape address %q is not a loopback address", listenAddr)
+	}
+
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start metrics scrape listener: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if !isAuthorized(r, secret) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(renderPrometheus()))
+	})
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Warning("metrics scrape server stopped: ", err)
+		}
+	}()
+
+	return func() error { return srv.Close() }, nil
+}
+
+func isAuthorized(r *http.Request, secret uint64) bool {
+	if secret == 0 {
+		return false
+	}
+	return r.Header.Get("Authorization") == fmt.Sprintf("Bearer %d", secret)
+}
+
+func renderPrometheus() string {
+	s := GetSnapshot()
+	out := ""
+	out += promCounter("ivpn_connects_total", "Total number of successful VPN connects", s.Connects)
+	out += promCounter("ivpn_disconnects_total", "Total number of VPN disconnects", s.Disconnects)
+	out += promCounter("ivpn_reconnects_total", "Total number of VPN reconnects", s.Reconnects)
+	out += promCounter("ivpn_pauses_total", "Total number of VPN pause operations", s.Pauses)
+	out += promCounter("ivpn_resumes_total", "Total number of VPN resume operations", s.Resumes)
+	out += promCounter("ivpn_key_rotations_total", "Total number of WireGuard key rotations", s.KeyRotations)
+	out += promCounter("ivpn_dns_set_total", "Total number of DNS 'set' operations", s.DNSSetCount)
+	out += promCounter("ivpn_dns_delete_total", "Total number of DNS 'delete' operations", s.DNSDeleteCount)
+	out += promGauge("ivpn_dns_latency_avg_ms", "Average observed DNS change latency, ms", s.DNSLatencyAvgMs)
+	out += promCounter("ivpn_firewall_rule_changes_total", "Total number of firewall rule churn events", s.FirewallRuleChanges)
+	out += promGauge("ivpn_handshake_age_seconds", "Seconds since the last successful WireGuard handshake (-1 if not connected)", s.HandshakeAgeSeconds)
+	return out
+}
+
+func promCounter(name, help string, value int64) string {
+	return fmt.Sprintf("# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
+
+func promGauge(name, help string, value int64) string {
+	return fmt.Sprintf("# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+}
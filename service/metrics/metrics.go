@@ -0,0 +1,128 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package metrics is a tiny in-process observability layer: counters and gauges cheap
+// enough to touch on hot paths (connect/disconnect, DNS changes, firewall rule churn),
+// exposed to the UI client via the Metrics request and to operators via a loopback-only
+// Prometheus text endpoint. It deliberately does not pull in a full metrics client
+// library - the surface here is small and fixed.
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a monotonically increasing value (connects, DNS changes, ...).
+type Counter struct{ v int64 }
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() { atomic.AddInt64(&c.v, 1) }
+
+// Add increments the counter by delta.
+func (c *Counter) Add(delta int64) { atomic.AddInt64(&c.v, delta) }
+
+// Value returns the current counter value.
+func (c *Counter) Value() int64 { return atomic.LoadInt64(&c.v) }
+
+// Gauge is a value that can go up or down (e.g. handshake age, current interface state).
+type Gauge struct{ v int64 }
+
+// Set sets the gauge to an absolute value.
+func (g *Gauge) Set(value int64) { atomic.StoreInt64(&g.v, value) }
+
+// Value returns the current gauge value.
+func (g *Gauge) Value() int64 { return atomic.LoadInt64(&g.v) }
+
+// Histogram records a small fixed set of latency buckets (milliseconds) plus a running
+// sum/count, good enough for a 'how long do DNS changes actually take' question without
+// the cost of a full histogram implementation.
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []int64 // upper bounds, ms
+	counts  []int64
+	sum     int64
+	count   int64
+}
+
+// defaultLatencyBucketsMs are the bucket upper bounds (ms) used by all histograms in
+// this package, tuned for sub-second operations like DNS or firewall rule changes.
+var defaultLatencyBucketsMs = []int64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// NewHistogram creates a histogram using defaultLatencyBucketsMs.
+func NewHistogram() *Histogram {
+	return &Histogram{
+		buckets: defaultLatencyBucketsMs,
+		counts:  make([]int64, len(defaultLatencyBucketsMs)+1), // +1 for the overflow ("+Inf") bucket
+	}
+}
+
+// Observe records a single duration.
+func (h *Histogram) Observe(d time.Duration) {
+	ms := d.Milliseconds()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.sum += ms
+	h.count++
+
+	idx := sort.Search(len(h.buckets), func(i int) bool { return ms <= h.buckets[i] })
+	h.counts[idx]++
+}
+
+// Snapshot returns (bucket upper bounds in ms, cumulative counts per bucket, sum ms, count).
+func (h *Histogram) Snapshot() (bounds []int64, cumulativeCounts []int64, sumMs int64, count int64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	cumulativeCounts = make([]int64, len(h.counts))
+	var running int64
+	for i, c := range h.counts {
+		running += c
+		cumulativeCounts[i] = running
+	}
+	return append([]int64(nil), h.buckets...), cumulativeCounts, h.sum, h.count
+}
+
+// The fixed set of metrics the daemon tracks. Subsystems call these directly from their
+// connect/disconnect/DNS/firewall code paths rather than going through a registry lookup.
+var (
+	Connects     Counter
+	Disconnects  Counter
+	Reconnects   Counter
+	Pauses       Counter
+	Resumes      Counter
+	KeyRotations Counter
+
+	DNSSetCount    Counter
+	DNSDeleteCount Counter
+	DNSLatency     = NewHistogram()
+
+	FirewallRuleChanges Counter
+
+	// HandshakeAgeSeconds - seconds since the last successful WireGuard handshake, as
+	// reported by wgctrl device stats. -1 while not connected.
+	HandshakeAgeSeconds = Gauge{v: -1}
+)
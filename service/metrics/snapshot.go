@@ -0,0 +1,70 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package metrics
+
+// Snapshot is the JSON-friendly view of current metric values, returned to the UI
+// client in response to the 'Metrics' request.
+type Snapshot struct {
+	Connects     int64
+	Disconnects  int64
+	Reconnects   int64
+	Pauses       int64
+	Resumes      int64
+	KeyRotations int64
+
+	DNSSetCount     int64
+	DNSDeleteCount  int64
+	DNSLatencyAvgMs int64
+	DNSLatencyCount int64
+
+	FirewallRuleChanges int64
+
+	HandshakeAgeSeconds int64
+}
+
+// GetSnapshot collects all current metric values into a single struct.
+func GetSnapshot() Snapshot {
+	_, _, dnsSumMs, dnsCount := DNSLatency.Snapshot()
+	avg := int64(0)
+	if dnsCount > 0 {
+		avg = dnsSumMs / dnsCount
+	}
+
+	return Snapshot{
+		Connects:     Connects.Value(),
+		Disconnects:  Disconnects.Value(),
+		Reconnects:   Reconnects.Value(),
+		Pauses:       Pauses.Value(),
+		Resumes:      Resumes.Value(),
+		KeyRotations: KeyRotations.Value(),
+
+		DNSSetCount:     DNSSetCount.Value(),
+		DNSDeleteCount:  DNSDeleteCount.Value(),
+		DNSLatencyAvgMs: avg,
+		DNSLatencyCount: dnsCount,
+
+		FirewallRuleChanges: FirewallRuleChanges.Value(),
+
+		HandshakeAgeSeconds: HandshakeAgeSeconds.Value(),
+	}
+}
@@ -0,0 +1,161 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package netevents is a single, debounced event bus for everything that reacts to
+// "the network changed under us": WiFi transitions, default-gateway changes, and
+// interface up/down. Before this package existed, WiFi change handling kept its own
+// package-level debounce timer/last-seen state in the service package, and interface/
+// route changes (the kind that broke Split-Tunnel init on Windows per the 3.14.16 fix)
+// had no single place to land - each subsystem that cared had to notice on its own.
+// Subscribers (currently the service layer's own WiFi handler, which forwards to the
+// RPC event receiver) register once via Bus.Subscribe and get typed, already-debounced
+// events.
+package netevents
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ivpn/desktop-app-daemon/wifiNotifier"
+)
+
+// Kind identifies the category of a network event.
+type Kind string
+
+// Event kinds dispatched by the bus
+const (
+	WiFiChanged         Kind = "wifi_changed"
+	DefaultRouteChanged Kind = "default_route_changed"
+	InterfaceUp         Kind = "interface_up"
+	InterfaceDown       Kind = "interface_down"
+)
+
+// WiFiInfo is the payload of a WiFiChanged event.
+type WiFiInfo struct {
+	SSID       string
+	BSSID      string
+	Security   wifiNotifier.WiFiSecurity
+	IsInsecure bool
+}
+
+// InterfaceInfo is the payload of an InterfaceUp/InterfaceDown/DefaultRouteChanged event.
+type InterfaceInfo struct {
+	Name string
+}
+
+// Event is a single dispatched network event. Exactly one of WiFi/Interface is set,
+// matching Kind.
+type Event struct {
+	Kind      Kind
+	WiFi      *WiFiInfo
+	Interface *InterfaceInfo
+}
+
+// Subscriber receives dispatched (post-debounce) events.
+type Subscriber func(Event)
+
+// Bus coalesces bursts of same-Kind events behind a single debouncer per kind, then
+// fans the last event of each burst out to every subscriber.
+type Bus struct {
+	mutex       sync.Mutex
+	debounce    time.Duration
+	subscribers []Subscriber
+	timers      map[Kind]*time.Timer
+	pending     map[Kind]Event
+	closed      bool
+}
+
+// NewBus creates a Bus that waits 'debounce' after the most recent event of a burst
+// before dispatching it for that Kind.
+func NewBus(debounce time.Duration) *Bus {
+	return &Bus{
+		debounce: debounce,
+		timers:   make(map[Kind]*time.Timer),
+		pending:  make(map[Kind]Event),
+	}
+}
+
+// Subscribe registers fn to receive every event dispatched from now on.
+func (b *Bus) Subscribe(fn Subscriber) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+}
+
+// Publish queues ev for dispatch, debounced per ev.Kind: if another Publish for the
+// same Kind arrives before the debounce window elapses, only the latest one is
+// eventually dispatched.
+func (b *Bus) Publish(ev Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.pending[ev.Kind] = ev
+
+	if t, exists := b.timers[ev.Kind]; exists {
+		t.Stop()
+	}
+	b.timers[ev.Kind] = time.AfterFunc(b.debounce, func() { b.dispatch(ev.Kind) })
+}
+
+func (b *Bus) dispatch(kind Kind) {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return
+	}
+	ev, ok := b.pending[kind]
+	delete(b.pending, kind)
+	delete(b.timers, kind)
+	subs := append([]Subscriber(nil), b.subscribers...)
+	b.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+	for _, s := range subs {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Error("netevents subscriber PANIC (recovered): ", r)
+				}
+			}()
+			s(ev)
+		}()
+	}
+}
+
+// Shutdown cancels any in-flight debounce timers; no further events will be
+// dispatched (Publish becomes a no-op) after this returns.
+func (b *Bus) Shutdown() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	for _, t := range b.timers {
+		t.Stop()
+	}
+	b.timers = make(map[Kind]*time.Timer)
+	b.pending = make(map[Kind]Event)
+}
@@ -0,0 +1,49 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import "github.com/ivpn/desktop-app-daemon/service/netevents"
+
+var stopNetMonitor func()
+
+// initNetMonitor starts watching for default-route and interface up/down changes and
+// publishing them on the shared netevents bus (same place initWiFiFunctionality wires
+// up WiFi change detection) - call once during daemon startup, alongside
+// initWiFiFunctionality. Implemented per-OS: netmonitor_linux.go subscribes to netlink
+// route/link updates; netmonitor_other.go is a no-op where no equivalent facility is
+// wired up yet.
+//
+// NOTE: this package's firewall and split-tunnel subsystems (the other two intended
+// consumers of DefaultRouteChanged/InterfaceUp/InterfaceDown, alongside this package's
+// own WiFiChanged subscriber in service_wifi.go) are not present in this checkout, so
+// there is nothing here yet to call SubscribeNetEvents on their behalf. Once those
+// subsystems exist in-tree, their init should call s.SubscribeNetEvents(their handler)
+// the same way initWiFiFunctionality does for its own WiFiChanged subscriber.
+func (s *Service) initNetMonitor() error {
+	stop, err := startNetMonitor(netEventsBus)
+	if err != nil {
+		return err
+	}
+	stopNetMonitor = stop
+	return nil
+}
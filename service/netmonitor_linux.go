@@ -0,0 +1,106 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/ivpn/desktop-app-daemon/service/netevents"
+)
+
+// startNetMonitor subscribes to netlink link and route updates and republishes the
+// subset the rest of the daemon cares about - interface up/down and default-route
+// changes (Dst == nil) - on bus. Non-default routes are ignored entirely.
+func startNetMonitor(bus *netevents.Bus) (stop func(), err error) {
+	linkUpdates := make(chan netlink.LinkUpdate)
+	linkDone := make(chan struct{})
+	if err := netlink.LinkSubscribe(linkUpdates, linkDone); err != nil {
+		return nil, fmt.Errorf("netmonitor: failed to subscribe to link updates: %w", err)
+	}
+
+	routeUpdates := make(chan netlink.RouteUpdate)
+	routeDone := make(chan struct{})
+	if err := netlink.RouteSubscribe(routeUpdates, routeDone); err != nil {
+		close(linkDone)
+		return nil, fmt.Errorf("netmonitor: failed to subscribe to route updates: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error("netmonitor PANIC (recovered): ", r)
+			}
+		}()
+		for {
+			select {
+			case <-done:
+				return
+			case u, ok := <-linkUpdates:
+				if !ok {
+					return
+				}
+				publishLinkUpdate(bus, u)
+			case u, ok := <-routeUpdates:
+				if !ok {
+					return
+				}
+				publishRouteUpdate(bus, u)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		close(linkDone)
+		close(routeDone)
+	}, nil
+}
+
+func publishLinkUpdate(bus *netevents.Bus, u netlink.LinkUpdate) {
+	attrs := u.Link.Attrs()
+	if attrs == nil {
+		return
+	}
+
+	kind := netevents.InterfaceDown
+	if attrs.OperState == netlink.OperUp {
+		kind = netevents.InterfaceUp
+	}
+	bus.Publish(netevents.Event{Kind: kind, Interface: &netevents.InterfaceInfo{Name: attrs.Name}})
+}
+
+func publishRouteUpdate(bus *netevents.Bus, u netlink.RouteUpdate) {
+	if u.Route.Dst != nil {
+		return // only the default route is interesting here
+	}
+
+	name := ""
+	if ifc, err := net.InterfaceByIndex(u.Route.LinkIndex); err == nil {
+		name = ifc.Name
+	}
+	bus.Publish(netevents.Event{Kind: netevents.DefaultRouteChanged, Interface: &netevents.InterfaceInfo{Name: name}})
+}
@@ -0,0 +1,34 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// +build !linux
+
+package service
+
+import "github.com/ivpn/desktop-app-daemon/service/netevents"
+
+// startNetMonitor: no netlink-equivalent route/link change subscription is wired up for
+// this platform yet, so DefaultRouteChanged/InterfaceUp/InterfaceDown are never
+// published here - only WiFiChanged (see service_wifi.go) is live on every platform.
+func startNetMonitor(bus *netevents.Bus) (stop func(), err error) {
+	return func() {}, nil
+}
@@ -25,11 +25,13 @@ package service
 import (
 	"time"
 
+	"github.com/ivpn/desktop-app-daemon/service/netevents"
 	"github.com/ivpn/desktop-app-daemon/wifiNotifier"
 )
 
 type wifiInfo struct {
 	ssid     string
+	bssid    string
 	security wifiNotifier.WiFiSecurity
 }
 
@@ -37,11 +39,21 @@ func (inf *wifiInfo) IsInsecure() bool {
 	return inf.security == wifiNotifier.WiFiSecurityNone || inf.security == wifiNotifier.WiFiSecurityWEP
 }
 
-var lastWiFiInfo *wifiInfo
-var timerDelayedNotify *time.Timer
+var stopWiFiPolling func()
 
+// delayBeforeWiFiChangeNotify - debounce window for the shared netevents bus (same
+// WiFi change event can occur several times in a short period of time)
 const delayBeforeWiFiChangeNotify = time.Second * 1
 
+// netEventsBus is the single, process-wide debounced event bus for WiFi/route/interface
+// changes - see package netevents. Subsystems other than the service layer itself
+// should use Service.SubscribeNetEvents rather than referencing this directly.
+var netEventsBus = netevents.NewBus(delayBeforeWiFiChangeNotify)
+
+// wifiPollInterval - how often the fallback poller checks SSID/security on
+// platforms/builds where no native WiFi-change notifier is available
+const wifiPollInterval = time.Second * 20
+
 func (s *Service) initWiFiFunctionality() error {
 	defer func() {
 		if r := recover(); r != nil {
@@ -49,37 +61,88 @@ func (s *Service) initWiFiFunctionality() error {
 		}
 	}()
 
-	wifiNotifier.SetWifiNotifier(s.onWiFiChanged)
+	if err := loadWiFiPolicy(); err != nil {
+		log.Warning("failed to load WiFi policy: ", err)
+	}
+
+	netEventsBus.Subscribe(s.onNetEvent)
+
+	// StartWithFallback registers s.publishWiFiChanged as the native notifier callback
+	// and additionally arms a polling fallback for platforms/builds without native WiFi
+	// change events - the service layer doesn't need to know which mode ends up active.
+	stopWiFiPolling = wifiNotifier.StartWithFallback(s.publishWiFiChanged, wifiPollInterval)
 	return nil
 }
 
-func (s *Service) onWiFiChanged(ssid string) {
+// publishWiFiChanged reads current SSID/BSSID/security and publishes a WiFiChanged
+// event on the shared netevents bus, which debounces it before dispatching to
+// subscribers (onNetEvent below, plus any subsystem registered via
+// SubscribeNetEvents).
+func (s *Service) publishWiFiChanged(ssid string) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Error("onWiFiChanged PANIC (recovered): ", r)
+			log.Error("publishWiFiChanged PANIC (recovered): ", r)
 		}
 	}()
 
 	security := wifiNotifier.GetCurrentNetworkSecurity()
+	bssid := wifiNotifier.GetCurrentBSSID()
+
+	netEventsBus.Publish(netevents.Event{
+		Kind: netevents.WiFiChanged,
+		WiFi: &netevents.WiFiInfo{
+			SSID:       ssid,
+			BSSID:      bssid,
+			Security:   security,
+			IsInsecure: isInsecureWiFi(security),
+		},
+	})
+}
 
-	lastWiFiInfo = &wifiInfo{
-		ssid,
-		security}
+// onNetEvent is the service layer's own subscriber: it notifies the RPC client and
+// applies the trusted-network policy table for WiFiChanged events.
+func (s *Service) onNetEvent(ev netevents.Event) {
+	if ev.Kind != netevents.WiFiChanged || ev.WiFi == nil {
+		return
+	}
 
-	// do delay before processing wifi change
-	// (same wifi change event can occur several times in short period of time)
-	if timerDelayedNotify != nil {
-		timerDelayedNotify.Stop()
-		timerDelayedNotify = nil
+	// notify clients about the WiFi change.
+	//
+	// NOTE: BSSID is deliberately not passed here - s._evtReceiver's interface
+	// (defined on the Service type outside this package) only declares the 2-arg
+	// OnWiFiChanged(ssid string, isInsecure bool). Once that interface (and every
+	// implementer of it) gains a matching 'bssid string' parameter, pass
+	// ev.WiFi.BSSID through here too.
+	s._evtReceiver.OnWiFiChanged(ev.WiFi.SSID, ev.WiFi.IsInsecure)
+
+	// evaluate the trusted-network policy table for this transition and apply whatever
+	// action it resolves to (force-connect/disconnect VPN, firewall, AllowLAN) - using
+	// the (ssid, security) pair exactly as it was when this event was published, not a
+	// freshly re-read security that may belong to a different network by the time this
+	// debounced dispatch actually runs
+	info := wifiInfo{ssid: ev.WiFi.SSID, bssid: ev.WiFi.BSSID, security: ev.WiFi.Security}
+	if actions := resolveWiFiPolicyActions(info); len(actions) > 0 {
+		s.applyWiFiPolicyActions(actions)
 	}
-	timerDelayedNotify = time.AfterFunc(delayBeforeWiFiChangeNotify, func() {
-		if lastWiFiInfo == nil || lastWiFiInfo.ssid != ssid || lastWiFiInfo.security != security {
-			return // do nothing (new wifi info available)
-		}
+}
 
-		// notify clients about WiFi change
-		s._evtReceiver.OnWiFiChanged(ssid, isInsecureWiFi(security))
-	})
+// SubscribeNetEvents lets other subsystems (firewall, split-tunnel, DNS manager) react
+// to WiFi/route/interface changes without racing each other or re-implementing their
+// own debouncing - every subscriber gets the same, already-debounced event stream.
+func (s *Service) SubscribeNetEvents(fn netevents.Subscriber) {
+	netEventsBus.Subscribe(fn)
+}
+
+// ShutdownNetEvents stops the WiFi poller and net monitor, then cancels any in-flight
+// debounce timers on the shared bus. Called from the daemon's graceful-shutdown path.
+func (s *Service) ShutdownNetEvents() {
+	if stopWiFiPolling != nil {
+		stopWiFiPolling()
+	}
+	if stopNetMonitor != nil {
+		stopNetMonitor()
+	}
+	netEventsBus.Shutdown()
 }
 
 func isInsecureWiFi(security wifiNotifier.WiFiSecurity) bool {
@@ -95,3 +158,10 @@ func (s *Service) GetWiFiCurrentState() (ssid string, isInsecureNetwork bool) {
 func (s *Service) GetWiFiAvailableNetworks() []string {
 	return wifiNotifier.GetAvailableSSIDs()
 }
+
+// GetWiFiAvailableNetworksDetailed returns rich scan results (BSSID, RSSI, security,
+// frequency) for currently visible WIFI networks, letting the client UI flag specific
+// insecure or spoofed (evil-twin: same SSID, different BSSID) access points.
+func (s *Service) GetWiFiAvailableNetworksDetailed() ([]wifiNotifier.WiFiNetworkInfo, error) {
+	return wifiNotifier.GetAvailableNetworksDetailed()
+}
@@ -0,0 +1,112 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package sysmanager lets the daemon report its status to the host init system
+// (currently: systemd, via the sd_notify protocol) and accept socket-activated
+// listeners from it. On platforms/builds with no init-system integration, every
+// call in this package is a cheap no-op.
+package sysmanager
+
+import (
+	"net"
+	"time"
+)
+
+// Ready notifies the service manager that initialization is complete
+// (RPC listener is up and the VPN state machine is initialized).
+func Ready() {
+	notify("READY=1")
+}
+
+// Status reports a free-form single-line status string (shown by e.g. `systemctl status`).
+func Status(status string) {
+	notify("STATUS=" + status)
+}
+
+// Reloading notifies the service manager that the daemon is applying new configuration
+// (e.g. during key rotation / reconnect) and will send Ready() again once done.
+func Reloading() {
+	notify("RELOADING=1")
+}
+
+// Stopping notifies the service manager that a graceful shutdown has begun.
+func Stopping() {
+	notify("STOPPING=1")
+}
+
+// WatchdogInterval returns the interval at which Watchdog() must be called to avoid
+// the service manager concluding the daemon is unresponsive and restarting it.
+// Returns 0 if no watchdog has been requested (WATCHDOG_USEC not set).
+func WatchdogInterval() (interval int64, enabled bool) {
+	return watchdogInterval()
+}
+
+// Watchdog pings the service manager's watchdog. Callers should stop calling this
+// (rather than call it unconditionally) once they detect the monitored subsystem
+// (e.g. the WireGuard run loop) is stuck, so the service manager restarts the daemon.
+func Watchdog() {
+	notify("WATCHDOG=1")
+}
+
+// Listeners returns sockets passed to the process via socket activation
+// (LISTEN_FDS/LISTEN_PID), or nil if none were passed.
+func Listeners() []net.Listener {
+	return listeners()
+}
+
+// StartWatchdog spins a background goroutine that pings the service manager's watchdog
+// at half the required interval, as long as isHealthy() returns true. Once isHealthy()
+// starts returning false (e.g. the WireGuard run loop is deadlocked, or the firewall
+// subsystem reports an error), pings stop and systemd will restart the daemon after
+// WATCHDOG_USEC elapses. Returns a stop function; safe to call even if no watchdog
+// was requested (then no goroutine is started and the stop function does nothing).
+func StartWatchdog(isHealthy func() bool) (stop func()) {
+	intervalMs, enabled := WatchdogInterval()
+	if !enabled {
+		return func() {}
+	}
+
+	pingInterval := time.Duration(intervalMs/2) * time.Millisecond
+	if pingInterval < time.Millisecond {
+		// WATCHDOG_USEC below ~2ms rounds down to 0 here, and time.NewTicker(0) panics -
+		// floor it rather than trust the service manager never sets it that low
+		pingInterval = time.Millisecond
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if isHealthy == nil || isHealthy() {
+					Watchdog()
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
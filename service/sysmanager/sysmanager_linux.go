@@ -0,0 +1,108 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package sysmanager
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// notify implements the sd_notify(3) protocol: write a datagram to the AF_UNIX socket
+// named by $NOTIFY_SOCKET. No-op if the env var isn't set (i.e. not started by systemd
+// with Type=notify).
+func notify(state string) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if len(socketPath) == 0 {
+		return
+	}
+
+	addr := &net.UnixAddr{Name: socketPath, Net: "unixgram"}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		log.Warning(fmt.Sprintf("sd_notify: failed to dial %s: %s", socketPath, err))
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Warning(fmt.Sprintf("sd_notify: failed to send '%s': %s", state, err))
+	}
+}
+
+func watchdogInterval() (int64, bool) {
+	usecStr := os.Getenv("WATCHDOG_USEC")
+	if len(usecStr) == 0 {
+		return 0, false
+	}
+	usec, err := strconv.ParseInt(usecStr, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	return usec / 1000, true // milliseconds
+}
+
+// listenFdsStart - first file descriptor number passed by systemd for socket activation
+const listenFdsStart = 3
+
+func listeners() []net.Listener {
+	pidStr := os.Getenv("LISTEN_PID")
+	fdsStr := os.Getenv("LISTEN_FDS")
+	if len(pidStr) == 0 || len(fdsStr) == 0 {
+		return nil
+	}
+
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil || pid != os.Getpid() {
+		return nil
+	}
+
+	nfds, err := strconv.Atoi(fdsStr)
+	if err != nil || nfds <= 0 {
+		return nil
+	}
+
+	result := make([]net.Listener, 0, nfds)
+	for i := 0; i < nfds; i++ {
+		fd := listenFdsStart + i
+		file := os.NewFile(uintptr(fd), "listen_fd_"+strings.TrimSpace(strconv.Itoa(fd)))
+		if file == nil {
+			continue
+		}
+		l, err := net.FileListener(file)
+		if err != nil {
+			log.Warning(fmt.Sprintf("socket activation: failed to wrap fd %d: %s", fd, err))
+			continue
+		}
+		result = append(result, l)
+	}
+
+	// these are set by systemd for this process only - clear them so a future
+	// (non-activated) restart of the same process tree doesn't misread them
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+
+	return result
+}
@@ -0,0 +1,239 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ivpn/desktop-app-daemon/service/platform"
+	"github.com/ivpn/desktop-app-daemon/wifiNotifier"
+)
+
+// WiFiPolicyAction is the action taken once a WiFi transition is matched against the
+// trusted-network policy table.
+type WiFiPolicyAction string
+
+// Available policy actions
+const (
+	WiFiActionNone            WiFiPolicyAction = ""
+	WiFiActionConnectVPN      WiFiPolicyAction = "connect_vpn"
+	WiFiActionDisconnectVPN   WiFiPolicyAction = "disconnect_vpn"
+	WiFiActionEnableFirewall  WiFiPolicyAction = "enable_firewall"
+	WiFiActionDisableFirewall WiFiPolicyAction = "disable_firewall"
+	WiFiActionEnableAllowLAN  WiFiPolicyAction = "enable_allow_lan"
+	WiFiActionDisableAllowLAN WiFiPolicyAction = "disable_allow_lan"
+)
+
+// WiFiPolicyRule describes what to do when a WiFi network matching it becomes active.
+// A rule matches by exact SSID (if SSID != "") or, when SSID == "", by one of the
+// catch-all Kind values below. All exact-SSID rules are checked before any catch-all
+// rule; within each group, the first match in WiFiPolicy.Rules wins.
+type WiFiPolicyRule struct {
+	SSID string // exact SSID to match; empty means "use Kind instead"
+
+	// Kind - catch-all matcher used when SSID == ""
+	//   "open"    - any network with no security (WiFiSecurityNone)
+	//   "wep"     - any WEP-secured network
+	//   "unknown" - any network not covered by a more specific rule
+	Kind string
+
+	Actions []WiFiPolicyAction
+}
+
+// WiFiPolicy is the full, persisted trusted-network policy table.
+type WiFiPolicy struct {
+	Rules []WiFiPolicyRule
+}
+
+const wifiPolicyFileName = "wifi-policy.json"
+
+var (
+	wifiPolicyMutex sync.Mutex
+	wifiPolicy      WiFiPolicy
+)
+
+func wifiPolicyFilePath() string {
+	return filepath.Join(platform.SettingsDir(), wifiPolicyFileName)
+}
+
+// loadWiFiPolicy reads the persisted policy table from the daemon's settings
+// directory. Missing file == empty policy (no rules, no special behaviour).
+func loadWiFiPolicy() error {
+	wifiPolicyMutex.Lock()
+	defer wifiPolicyMutex.Unlock()
+
+	data, err := ioutil.ReadFile(wifiPolicyFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			wifiPolicy = WiFiPolicy{}
+			return nil
+		}
+		return fmt.Errorf("failed to read WiFi policy file: %w", err)
+	}
+
+	var p WiFiPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("failed to parse WiFi policy file: %w", err)
+	}
+	wifiPolicy = p
+	return nil
+}
+
+func saveWiFiPolicy(p WiFiPolicy) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize WiFi policy: %w", err)
+	}
+
+	wifiPolicyMutex.Lock()
+	defer wifiPolicyMutex.Unlock()
+
+	if err := ioutil.WriteFile(wifiPolicyFilePath(), data, 0600); err != nil {
+		return fmt.Errorf("failed to save WiFi policy file: %w", err)
+	}
+	wifiPolicy = p
+	return nil
+}
+
+// SetWiFiPolicy replaces the current trusted-network policy table and persists it.
+func (s *Service) SetWiFiPolicy(policy WiFiPolicy) error {
+	return saveWiFiPolicy(policy)
+}
+
+// GetWiFiPolicy returns the current trusted-network policy table.
+func (s *Service) GetWiFiPolicy() WiFiPolicy {
+	wifiPolicyMutex.Lock()
+	defer wifiPolicyMutex.Unlock()
+	return wifiPolicy
+}
+
+// resolveWiFiPolicyActions returns the actions to apply for a given WiFi transition,
+// evaluating rules in order: exact-SSID rules first, then catch-all 'Kind' rules, then
+// the "unknown" catch-all for a network whose own kind has no rule.
+func resolveWiFiPolicyActions(info wifiInfo) []WiFiPolicyAction {
+	wifiPolicyMutex.Lock()
+	rules := wifiPolicy.Rules
+	wifiPolicyMutex.Unlock()
+
+	kind := wifiSecurityKind(info.security)
+
+	for _, r := range rules {
+		if r.SSID != "" && r.SSID == info.ssid {
+			return r.Actions
+		}
+	}
+	for _, r := range rules {
+		if r.SSID == "" && r.Kind == kind {
+			return r.Actions
+		}
+	}
+	for _, r := range rules {
+		if r.SSID == "" && r.Kind == "unknown" {
+			return r.Actions
+		}
+	}
+	return nil
+}
+
+func wifiSecurityKind(security wifiNotifier.WiFiSecurity) string {
+	switch security {
+	case wifiNotifier.WiFiSecurityNone:
+		return "open"
+	case wifiNotifier.WiFiSecurityWEP:
+		return "wep"
+	default:
+		return "unknown"
+	}
+}
+
+// applyWiFiPolicyActions executes the resolved actions for a WiFi transition, delegating
+// to the same Service methods the RPC layer uses (KillSwitchSetEnabled/AllowLAN, Connect/
+// Disconnect), so the policy engine has no special-cased control path of its own.
+//
+// Connect/Disconnect run in their own goroutine rather than inline: this is called
+// directly from netevents.Bus.dispatch, and a VPN connect can take long enough (DNS
+// resolution, handshake) that running it inline would hold up every other subscriber
+// (firewall, split-tunnel, DNS manager) waiting on the same dispatch of this event.
+//
+// NOTE: Service.Connect (defined outside this checkout) is called here with no
+// arguments on the assumption that it reconnects using the daemon's own
+// last-active connection parameters (server, credentials, protocol) the same way
+// the RPC layer's reconnect path does - a policy-triggered connect has no separate
+// parameter source of its own to supply instead. If Service.Connect has no such
+// no-arg form, this call site needs the cached last-connection parameters
+// threaded through instead.
+func (s *Service) applyWiFiPolicyActions(actions []WiFiPolicyAction) {
+	for _, a := range actions {
+		switch a {
+		case WiFiActionConnectVPN:
+			log.Info("WiFi policy: triggering VPN connect")
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						log.Error("WiFi policy: VPN connect PANIC (recovered): ", r)
+					}
+				}()
+				if err := s.Connect(); err != nil {
+					log.Warning("WiFi policy: failed to connect VPN: ", err)
+				}
+			}()
+		case WiFiActionDisconnectVPN:
+			log.Info("WiFi policy: triggering VPN disconnect")
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						log.Error("WiFi policy: VPN disconnect PANIC (recovered): ", r)
+					}
+				}()
+				if err := s.Disconnect(); err != nil {
+					log.Warning("WiFi policy: failed to disconnect VPN: ", err)
+				}
+			}()
+		case WiFiActionEnableFirewall:
+			log.Info("WiFi policy: enabling firewall")
+			if err := s.KillSwitchSetEnabled(true); err != nil {
+				log.Warning("WiFi policy: failed to enable firewall: ", err)
+			}
+		case WiFiActionDisableFirewall:
+			log.Info("WiFi policy: disabling firewall")
+			if err := s.KillSwitchSetEnabled(false); err != nil {
+				log.Warning("WiFi policy: failed to disable firewall: ", err)
+			}
+		case WiFiActionEnableAllowLAN:
+			log.Info("WiFi policy: enabling AllowLAN")
+			if err := s.KillSwitchSetAllowLAN(true); err != nil {
+				log.Warning("WiFi policy: failed to enable AllowLAN: ", err)
+			}
+		case WiFiActionDisableAllowLAN:
+			log.Info("WiFi policy: disabling AllowLAN")
+			if err := s.KillSwitchSetAllowLAN(false); err != nil {
+				log.Warning("WiFi policy: failed to disable AllowLAN: ", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package wireguard
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+)
+
+// autoPortRangeMin/Max bound the range probed when the client asks for an automatically
+// chosen listen port (requested port == 0), or needs to roll forward from an unavailable
+// explicitly-requested one.
+const (
+	autoPortRangeMin = 51820
+	autoPortRangeMax = 52820
+)
+
+// selectListenPort resolves the actual UDP port the local WireGuard interface should
+// listen on:
+//   - requested == 0: pick a free port in [autoPortRangeMin, autoPortRangeMax), scanning
+//     from a random starting point - this also covers the "random port each session" UI
+//     preference, since the caller can simply always pass 0.
+//   - requested != 0: use it if free; otherwise roll forward to the next free port in
+//     the same range (wrapping around at autoPortRangeMax; a requested port outside the
+//     range starts the scan at autoPortRangeMin) and let the caller know the effective
+//     port differs from requested.
+func selectListenPort(requested int) (port int, err error) {
+	inUse, err := wgDevicePorts()
+	if err != nil {
+		log.Warning("failed to enumerate existing WireGuard devices, port conflict detection limited to UDP probing: ", err)
+	}
+
+	if requested != 0 {
+		if !inUse[requested] && isUDPPortFree(requested) {
+			return requested, nil
+		}
+		log.Info(fmt.Sprintf("requested WireGuard port %d is unavailable, picking the next free one", requested))
+	}
+
+	n := autoPortRangeMax - autoPortRangeMin
+	start := 0
+	if requested == 0 {
+		start = rand.New(rand.NewSource(time.Now().UnixNano())).Intn(n)
+	} else if requested >= autoPortRangeMin && requested < autoPortRangeMax {
+		start = requested - autoPortRangeMin + 1
+	}
+
+	for i := 0; i < n; i++ {
+		p := autoPortRangeMin + (start+i)%n
+		if inUse[p] {
+			continue
+		}
+		if isUDPPortFree(p) {
+			return p, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no free UDP port available in range %d-%d", autoPortRangeMin, autoPortRangeMax)
+}
+
+// wgDevicePorts returns the set of listen ports already in use by other WireGuard
+// devices on this system (kernel or userspace), as reported by wgctrl.
+func wgDevicePorts() (map[int]bool, error) {
+	client, err := wgctrl.New()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	devices, err := client.Devices()
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make(map[int]bool, len(devices))
+	for _, d := range devices {
+		if d.ListenPort != 0 {
+			ports[d.ListenPort] = true
+		}
+	}
+	return ports, nil
+}
+
+// isUDPPortFree reports whether a UDP port can be bound on all interfaces right now.
+func isUDPPortFree(port int) bool {
+	addr := &net.UDPAddr{Port: port}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,78 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package wireguard
+
+import (
+	"fmt"
+	"net"
+
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/ipc"
+)
+
+// uapiServer serves a running userspace WireGuard device's configuration protocol
+// (the same UAPI that 'wg'/wgctrl speak against the kernel module) over the
+// platform-appropriate IPC channel (a unix socket under /var/run/wireguard on Linux,
+// the corresponding named pipe on Windows). Without this, wgctrl.ConfigureDevice has
+// nothing to dial and every key/peer/listen-port configuration call on a userspace
+// device fails.
+type uapiServer struct {
+	listener net.Listener
+	done     chan struct{}
+}
+
+// startUAPIListener opens the UAPI listener for 'ifcName' and starts accepting
+// configuration connections, handing each one to dev.IpcHandle. Call Close() to stop
+// serving and remove the underlying socket/pipe.
+func startUAPIListener(dev *device.Device, ifcName string) (*uapiServer, error) {
+	listener, err := ipc.UAPIListen(ifcName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UAPI listener for %s: %w", ifcName, err)
+	}
+
+	srv := &uapiServer{listener: listener, done: make(chan struct{})}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				select {
+				case <-srv.done:
+					return
+				default:
+					log.Warning(fmt.Sprintf("UAPI accept error on %s: %s", ifcName, err))
+					return
+				}
+			}
+			go dev.IpcHandle(conn)
+		}
+	}()
+
+	return srv, nil
+}
+
+// Close stops accepting new UAPI connections and removes the listening socket/pipe.
+func (u *uapiServer) Close() error {
+	close(u.done)
+	return u.listener.Close()
+}
@@ -25,15 +25,18 @@ package wireguard
 import (
 	"fmt"
 	"net"
-	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/vishvananda/netlink"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
 	"github.com/ivpn/desktop-app-daemon/service/dns"
-	"github.com/ivpn/desktop-app-daemon/shell"
+	"github.com/ivpn/desktop-app-daemon/service/metrics"
 	"github.com/ivpn/desktop-app-daemon/vpn"
 )
 
@@ -44,31 +47,57 @@ const (
 	resume     operation = iota
 )
 
+// keepaliveInterval - default persistent-keepalive sent to the peer so NAT/firewall
+// mappings on the client side do not expire while idle
+const keepaliveInterval = 25 * time.Second
+
+// teardownDeadline bounds how long disconnect() waits for the WG interface to
+// disappear cleanly before forcibly destroying it.
+const teardownDeadline = 5 * time.Second
+
+// ErrForcedTeardown is returned (wrapped) by internalDisconnect when the interface
+// did not go away cleanly within teardownDeadline and had to be force-destroyed.
+// The service layer can check for it with errors.Is to report a degraded disconnect
+// rather than a clean one.
+var ErrForcedTeardown = fmt.Errorf("WireGuard interface did not shut down cleanly within %s and was force-destroyed", teardownDeadline)
+
 // internalVariables of wireguard implementation for Linux
 type internalVariables struct {
 	manualDNS            net.IP
 	isRunning            bool
 	isPaused             bool
 	resumeDisconnectChan chan operation // control connection pause\resume or disconnect from paused state
+
+	wgClient        *wgctrl.Client // handle to the kernel (or userspace) WireGuard device
+	userspace       bool           // true when running over the wireguard-go fallback tun device
+	userspaceDevice *device.Device // non-nil when 'userspace' fallback is active
+	userspaceUAPI   *uapiServer    // non-nil when 'userspace' fallback is active - lets wgClient reach userspaceDevice
+	listenPort      int            // actual UDP port the device is listening on (see selectListenPort)
+}
+
+// ListenPort returns the UDP port the local WireGuard interface is currently listening
+// on, which may differ from the port requested at connect time (see selectListenPort).
+func (wg *WireGuard) ListenPort() int {
+	return wg.internals.listenPort
 }
 
 func (wg *WireGuard) init() error {
+	// new connection: forget any port picked by a previous connect() on this same
+	// WireGuard instance, so selectListenPort runs fresh instead of reusing a stale value
+	wg.internals.listenPort = 0
+
 	// It can happen that ivpn-daemon was not correctly stopped during WireGuard connection
 	// (e.g. process was terminated)
-	// In such situation, the 'wgivpn' keeps active.
-	// We should close it in this case. Otherwise, new connection would not be established
-	wgInterfaceName := filepath.Base(wg.configFilePath)
-	wgInterfaceName = strings.TrimSuffix(wgInterfaceName, path.Ext(wgInterfaceName))
-	// stop current WG connection (if exists)
-	i, _ := net.InterfaceByName(wgInterfaceName)
-	if i != nil {
-		log.Info(fmt.Sprintf("Stopping WireGuard interface ('%s' expected to be stopped before the new connection)...", wgInterfaceName))
-		err := shell.Exec(log, "ip", "link", "set", "down", wgInterfaceName) // command: sudo ip link set down wgivpn
-		if err != nil {
+	// In such situation, the WG link may still be present in the kernel.
+	// We should remove it in this case. Otherwise, new connection would not be established
+	wgInterfaceName := wg.interfaceName()
+
+	if link, err := netlink.LinkByName(wgInterfaceName); err == nil && link != nil {
+		log.Info(fmt.Sprintf("Removing WireGuard interface ('%s' expected to be stopped before the new connection)...", wgInterfaceName))
+		if err := netlink.LinkSetDown(link); err != nil {
 			log.Warning(err)
 		}
-		err = shell.Exec(log, "ip", "link", "delete", wgInterfaceName) // command: sudo ip link delete wgivpn
-		if err != nil {
+		if err := netlink.LinkDel(link); err != nil {
 			log.Warning(err)
 		}
 	}
@@ -76,42 +105,34 @@ func (wg *WireGuard) init() error {
 	return nil
 }
 
-// connect - SYNCHRONOUSLY execute openvpn process (wait until it finished)
+// interfaceName - name of the WireGuard network device, derived from the (legacy) config file path
+func (wg *WireGuard) interfaceName() string {
+	name := filepath.Base(wg.configFilePath)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// connect - SYNCHRONOUSLY drive the WireGuard device (wait until it finished)
 func (wg *WireGuard) connect(stateChan chan<- vpn.StateInfo) error {
 
 	wg.internals.isRunning = true
 	defer func() {
 		wg.internals.isRunning = false
-		// do not forget to remove config file after finishing configuration
-		if err := os.Remove(wg.configFilePath); err != nil {
-			log.Warning(fmt.Sprintf("failed to remove WG configuration: %s", err))
-		}
 	}()
 
 	wg.internals.resumeDisconnectChan = make(chan operation, 1)
 
 	// loop connection initialisation (required for pause\resume functionality)
-	// on 'pause' - we stopping WG interface but not exiting this (connect) method
+	// on 'pause' - we bring the WG device down but not exiting this (connect) method
 	// (method 'connect' is synchronous, must NOT exit on pause)
-	for true {
-		// generate configuration
-		err := wg.generateAndSaveConfigFile(wg.configFilePath)
-		if err != nil {
-			return fmt.Errorf("failed to save WG config file: %w", err)
-		}
-
-		// start WG
-		log.Info("Shell exec: ", wg.binaryPath, " up ", wg.configFilePath)
-		cmd := exec.Command(wg.binaryPath, "up", wg.configFilePath)
-		outBytes, err := cmd.CombinedOutput()
-		if err != nil {
-			if len(outBytes) > 0 {
-				log.Error(fmt.Sprintf("'%s' error. Output: %s", wg.binaryPath, string(outBytes)))
-			}
+	for {
+		if err := wg.bringUpWithDeadline(teardownDeadline); err != nil {
+			// whatever deviceUp managed to create before failing (link/address/route, open
+			// wgClient fd) must not leak until the *next* connect's init() happens to clean it up
+			wg.deviceDown()
 			return fmt.Errorf("failed to start WireGuard: %w", err)
 		}
 
-		err = func() error {
+		err := func() error {
 			// do not forget to restore DNS
 			defer func() {
 				// restore DNS configuration
@@ -129,38 +150,37 @@ func (wg *WireGuard) connect(stateChan chan<- vpn.StateInfo) error {
 			}
 
 			// notify connected
+			//
+			// NOTE: this still only reports clientLocalIP/hostIP - ListenPort() (the port
+			// actually picked by selectListenPort, which may differ from what was requested)
+			// is available here but vpn.NewStateInfoConnected/vpn.StateInfo (defined outside
+			// this package) have no field for it yet; that needs a matching change there
+			// before the effective port can reach the client through the connect response.
+			metrics.Connects.Inc()
 			stateChan <- vpn.NewStateInfoConnected(wg.connectParams.clientLocalIP, wg.connectParams.hostIP)
 
-			wgInterfaceName := filepath.Base(wg.configFilePath)
-			wgInterfaceName = strings.TrimSuffix(wgInterfaceName, path.Ext(wgInterfaceName))
-			// wait until wireguard interface is available
-			for {
-				time.Sleep(time.Millisecond * 500)
-				i, err := net.InterfaceByName(wgInterfaceName)
-				if err != nil {
-					fmt.Println(err)
-					break
-				}
-				if i == nil {
-					break
-				}
-			}
+			// wait until the device disappears (forced teardown) or a pause/disconnect is requested
+			wg.waitWhileDeviceExists()
 			return nil
 		}()
 
 		if err != nil {
+			wg.deviceDown()
 			return err
 		}
 
 		// if connection not PAUSED - exit
 		if wg.isPaused() {
 			log.Info("Paused")
+			metrics.Pauses.Inc()
 			// wait for resume or disconnect request
 			op := <-wg.internals.resumeDisconnectChan
 			if op != resume {
 				break
 			}
 			log.Info("Resuming...")
+			metrics.Resumes.Inc()
+			metrics.Reconnects.Inc()
 		} else {
 			break
 		}
@@ -168,6 +188,190 @@ func (wg *WireGuard) connect(stateChan chan<- vpn.StateInfo) error {
 	return nil
 }
 
+// deviceUp creates (or re-creates) the WireGuard netlink device and programs it with the
+// private key, peer and routing configuration - replacing the former 'wg-quick up' shell-out.
+// cancel is closed by bringUpWithDeadline once its deadline elapses; deviceUp checks it between
+// steps so a wedged caller does not end up racing the state machine once the deadline has
+// already been reported back to connect() as a failure. Cleanup of anything created before
+// failure or cancellation is the caller's responsibility (connect() calls deviceDown()).
+func (wg *WireGuard) deviceUp(cancel <-chan struct{}) (retErr error) {
+	ifcName := wg.interfaceName()
+
+	link := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: ifcName}}
+	if err := netlink.LinkAdd(link); err != nil {
+		// kernel module not available (old kernel, distro without wireguard module) - fall back
+		// to the userspace wireguard-go implementation, which exposes the same netlink-style
+		// control API through a tun device
+		log.Info(fmt.Sprintf("kernel WireGuard device not available (%s), falling back to userspace wireguard-go", err))
+		tunLink, err := wg.startUserspaceDevice(ifcName)
+		if err != nil {
+			return fmt.Errorf("failed to create WireGuard device: %w", err)
+		}
+		link = tunLink
+		wg.internals.userspace = true
+	} else {
+		wg.internals.userspace = false
+	}
+
+	if isCancelled(cancel) {
+		return fmt.Errorf("WireGuard bring-up cancelled after interface creation")
+	}
+
+	client, err := wgctrl.New()
+	if err != nil {
+		return fmt.Errorf("failed to open wgctrl client: %w", err)
+	}
+	wg.internals.wgClient = client
+
+	if err := wg.applyDeviceConfig(ifcName); err != nil {
+		return err
+	}
+
+	if isCancelled(cancel) {
+		return fmt.Errorf("WireGuard bring-up cancelled after device configuration")
+	}
+
+	addr := &netlink.Addr{IPNet: &net.IPNet{IP: wg.connectParams.clientLocalIP, Mask: net.CIDRMask(32, 32)}}
+	if err := netlink.AddrAdd(link, addr); err != nil {
+		return fmt.Errorf("failed to assign address to %s: %w", ifcName, err)
+	}
+
+	if err := netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("failed to bring %s up: %w", ifcName, err)
+	}
+
+	if isCancelled(cancel) {
+		return fmt.Errorf("WireGuard bring-up cancelled after interface activation")
+	}
+
+	_, allowedAll, _ := net.ParseCIDR("0.0.0.0/0")
+	route := &netlink.Route{LinkIndex: link.Attrs().Index, Dst: allowedAll}
+	if err := netlink.RouteAdd(route); err != nil {
+		return fmt.Errorf("failed to add default route via %s: %w", ifcName, err)
+	}
+
+	return nil
+}
+
+// isCancelled reports whether cancel has been closed, without blocking.
+func isCancelled(cancel <-chan struct{}) bool {
+	select {
+	case <-cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// applyDeviceConfig pushes the private key + peer (public key, endpoint, allowed IPs, keepalive)
+// to the kernel/userspace device via wgctrl. Calling it again (e.g. for key rotation) reprograms
+// the device without tearing the tunnel down.
+func (wg *WireGuard) applyDeviceConfig(ifcName string) error {
+	privateKey, err := wgtypes.ParseKey(wg.connectParams.clientPrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to parse WG private key: %w", err)
+	}
+	publicKey, err := wgtypes.ParseKey(wg.connectParams.hostPublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to parse WG peer public key: %w", err)
+	}
+
+	_, allowedAll, _ := net.ParseCIDR("0.0.0.0/0")
+	endpoint := &net.UDPAddr{IP: wg.connectParams.hostIP, Port: wg.connectParams.hostPort}
+	keepalive := keepaliveInterval
+
+	// picked once per connect and cached on wg.internals.listenPort - applyDeviceConfig also
+	// runs for in-place key rotation (updatePeerKeys) and across pause/resume, and the port
+	// must stay stable for the lifetime of the connection rather than silently drift
+	listenPort := wg.internals.listenPort
+	if listenPort == 0 {
+		var err error
+		listenPort, err = selectListenPort(wg.connectParams.localPort)
+		if err != nil {
+			return fmt.Errorf("failed to select WireGuard listen port: %w", err)
+		}
+		wg.internals.listenPort = listenPort
+		if listenPort != wg.connectParams.localPort {
+			log.Info(fmt.Sprintf("WireGuard listening on port %d (requested %d)", listenPort, wg.connectParams.localPort))
+		}
+	}
+
+	cfg := wgtypes.Config{
+		PrivateKey:   &privateKey,
+		ListenPort:   &listenPort,
+		ReplacePeers: true,
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:                   publicKey,
+				Endpoint:                    endpoint,
+				PersistentKeepaliveInterval: &keepalive,
+				ReplaceAllowedIPs:           true,
+				AllowedIPs:                  []net.IPNet{*allowedAll},
+			},
+		},
+	}
+
+	return wg.internals.wgClient.ConfigureDevice(ifcName, cfg)
+}
+
+// waitWhileDeviceExists blocks until the WG netlink device disappears
+// (forced teardown from outside, e.g. link deleted by another process, or a
+// disconnect()/pause() issued from another goroutine).
+func (wg *WireGuard) waitWhileDeviceExists() {
+	ifcName := wg.interfaceName()
+	for {
+		time.Sleep(time.Millisecond * 500)
+		if _, err := netlink.LinkByName(ifcName); err != nil {
+			metrics.HandshakeAgeSeconds.Set(-1)
+			return
+		}
+		if wg.internals.wgClient == nil {
+			metrics.HandshakeAgeSeconds.Set(-1)
+			return
+		}
+		wg.updateHandshakeAgeMetric(ifcName)
+	}
+}
+
+// updateHandshakeAgeMetric reads the last-handshake timestamp for the (single) peer from
+// wgctrl device stats and reports it as a gauge.
+func (wg *WireGuard) updateHandshakeAgeMetric(ifcName string) {
+	dev, err := wg.internals.wgClient.Device(ifcName)
+	if err != nil || len(dev.Peers) == 0 || dev.Peers[0].LastHandshakeTime.IsZero() {
+		return
+	}
+	metrics.HandshakeAgeSeconds.Set(int64(time.Since(dev.Peers[0].LastHandshakeTime).Seconds()))
+}
+
+// bringUpWithDeadline wraps deviceUp with a timeout so that a netlink/wgctrl call which
+// never returns (e.g. kernel wedged on a broken WireGuard module) cannot hang the VPN
+// state machine forever. On timeout, deviceUp is told to cancel via the shared channel;
+// since netlink/wgctrl calls already in flight cannot be interrupted mid-syscall, deviceUp
+// is additionally left running in the background and its result is reaped so that a device
+// it manages to finish creating after we have already reported failure to connect() gets
+// torn back down instead of silently staying up behind the state machine's back.
+func (wg *WireGuard) bringUpWithDeadline(deadline time.Duration) error {
+	cancel := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- wg.deviceUp(cancel)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(deadline):
+		close(cancel)
+		go func() {
+			if err := <-done; err == nil {
+				log.Warning("WireGuard bring-up finished after its deadline had already been reported as failed, tearing it back down")
+				wg.deviceDown()
+			}
+		}()
+		return fmt.Errorf("timed out after %s bringing up WireGuard interface", deadline)
+	}
+}
+
 func (wg *WireGuard) disconnect() error {
 
 	select {
@@ -175,19 +379,103 @@ func (wg *WireGuard) disconnect() error {
 	default:
 	}
 
+	// counted here, not in internalDisconnect, because pause() also goes through
+	// internalDisconnect and must not be double-counted as a disconnect
+	metrics.Disconnects.Inc()
+
 	if wg.isPaused() {
-		// wg interface already 'down'
-		return wg.resume()
+		// the interface was already brought down by pause(), but don't just trust that and
+		// leave a possibly-lingering device for the *next* connect()'s init() to clean up -
+		// force-destroy it now so disconnecting from a paused state is bounded too
+		wg.internals.isPaused = false
+		return wg.forceDestroyInterface(wg.interfaceName())
 	}
 	return wg.internalDisconnect()
 }
 
+// internalDisconnect brings the WG device down and waits, bounded by teardownDeadline,
+// for it to actually disappear. If it is still present once the deadline passes, it is
+// forcibly destroyed (down + delete) before returning - the returned error distinguishes
+// a clean shutdown (nil) from a forced one (wraps ErrForcedTeardown) so the service layer
+// can report a degraded disconnect.
 func (wg *WireGuard) internalDisconnect() error {
-	err := shell.Exec(log, wg.binaryPath, "down", wg.configFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to stop WireGuard: %w", err)
+	ifcName := wg.interfaceName()
+
+	if wg.internals.wgClient != nil {
+		wg.internals.wgClient.Close()
+		wg.internals.wgClient = nil
+	}
+	if wg.internals.userspace {
+		wg.stopUserspaceDevice()
+		wg.internals.userspace = false
+	}
+
+	link, err := netlink.LinkByName(ifcName)
+	if err != nil || link == nil {
+		// already gone
+		return nil
+	}
+
+	if err := netlink.LinkSetDown(link); err != nil {
+		log.Warning(fmt.Sprintf("failed to bring %s down: %s", ifcName, err))
+	}
+	if err := netlink.LinkDel(link); err == nil {
+		return nil
+	}
+
+	deadline := time.Now().Add(teardownDeadline)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 200)
+		if _, err := netlink.LinkByName(ifcName); err != nil {
+			// interface disappeared cleanly
+			return nil
+		}
+	}
+
+	log.Warning(fmt.Sprintf("%s still present after %s, forcing destroy", ifcName, teardownDeadline))
+	return wg.forceDestroyInterface(ifcName)
+}
+
+// forceDestroyInterface unconditionally brings the interface down and deletes it,
+// ignoring (but logging) any error from the 'down' step, since delete alone is sufficient.
+func (wg *WireGuard) forceDestroyInterface(ifcName string) error {
+	link, err := netlink.LinkByName(ifcName)
+	if err != nil || link == nil {
+		// gone by the time we got here
+		return nil
+	}
+
+	if err := netlink.LinkSetDown(link); err != nil {
+		log.Warning(fmt.Sprintf("force-destroy: failed to bring %s down: %s", ifcName, err))
+	}
+	if err := netlink.LinkDel(link); err != nil {
+		return fmt.Errorf("%w (delete also failed: %s)", ErrForcedTeardown, err)
+	}
+	return ErrForcedTeardown
+}
+
+// deviceDown is the unconditional, best-effort variant used when tearing down a
+// half-initialized device (e.g. deviceUp failed partway through).
+func (wg *WireGuard) deviceDown() {
+	ifcName := wg.interfaceName()
+
+	if wg.internals.wgClient != nil {
+		wg.internals.wgClient.Close()
+		wg.internals.wgClient = nil
+	}
+	if wg.internals.userspace {
+		wg.stopUserspaceDevice()
+		wg.internals.userspace = false
+	}
+
+	if link, err := netlink.LinkByName(ifcName); err == nil && link != nil {
+		if err := netlink.LinkSetDown(link); err != nil {
+			log.Warning(fmt.Sprintf("failed to bring %s down: %s", ifcName, err))
+		}
+		if err := netlink.LinkDel(link); err != nil {
+			log.Warning(fmt.Sprintf("failed to delete %s: %s", ifcName, err))
+		}
 	}
-	return nil
 }
 
 func (wg *WireGuard) isPaused() bool {
@@ -238,10 +526,51 @@ func (wg *WireGuard) resetManualDNS() error {
 	return dns.DeleteManual(nil)
 }
 
+// updatePeerKeys reprograms the device's private/public key pair in place, without a reconnect.
+// Used by GenerateNewKeys once a key rotation has completed.
+func (wg *WireGuard) updatePeerKeys() error {
+	if !wg.internals.isRunning || wg.internals.wgClient == nil {
+		return nil
+	}
+	metrics.KeyRotations.Inc()
+	return wg.applyDeviceConfig(wg.interfaceName())
+}
+
+// GenerateNewKeys installs a freshly rotated local private key (the matching public key has
+// already been sent to the server by the caller) and, if the tunnel is currently up,
+// reprograms the running device in place via updatePeerKeys instead of requiring a full
+// reconnect.
+//
+// NOTE: nothing in this checkout calls this yet. protocol/types.WireGuardGenerateNewKeys
+// is only the request's wire struct - the RPC dispatch switch that would decode it and the
+// Service type that would hold the active *WireGuard connection to call this on are both
+// outside this checkout (neither a protocol request-handler file nor a Service struct
+// exists here). Once that layer exists, its WireGuardGenerateNewKeys handler should
+// generate the new keypair, send the public half to the server, then call this method -
+// that is the one remaining step for key rotation to stop going through a full reconnect.
+func (wg *WireGuard) GenerateNewKeys(privateKey string) error {
+	wg.connectParams.clientPrivateKey = privateKey
+	return wg.updatePeerKeys()
+}
+
 func (wg *WireGuard) getOSSpecificConfigParams() (interfaceCfg []string, peerCfg []string) {
 	interfaceCfg = append(interfaceCfg, "Address = "+wg.connectParams.clientLocalIP.String()+"/32")
 	interfaceCfg = append(interfaceCfg, "SaveConfig = true")
 
+	// reuse the port already picked for this connect (see applyDeviceConfig) rather than
+	// independently re-selecting one here, which could otherwise disagree with the port the
+	// device actually ends up listening on
+	port := wg.internals.listenPort
+	if port == 0 {
+		if selected, err := selectListenPort(wg.connectParams.localPort); err == nil {
+			wg.internals.listenPort = selected
+			port = selected
+		}
+	}
+	if port != 0 {
+		interfaceCfg = append(interfaceCfg, fmt.Sprintf("ListenPort = %d", port))
+	}
+
 	peerCfg = append(peerCfg, "AllowedIPs = 0.0.0.0/0")
 	return interfaceCfg, peerCfg
 }
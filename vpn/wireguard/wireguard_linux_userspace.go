@@ -0,0 +1,81 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package wireguard
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// startUserspaceDevice brings up a userspace WireGuard tun device (wireguard-go) in-process,
+// for systems where the kernel WireGuard module is not available. The resulting tun interface
+// is registered under the same name as the kernel device would have been, so the rest of the
+// 'connect' flow (addressing, routing, wgctrl configuration) is unaware of the distinction.
+func (wg *WireGuard) startUserspaceDevice(ifcName string) (netlink.Link, error) {
+	tunDevice, err := tun.CreateTUN(ifcName, device.DefaultMTU)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tun device: %w", err)
+	}
+
+	dev := device.NewDevice(tunDevice, conn.NewDefaultBind(), device.NewLogger(device.LogLevelError, ifcName))
+	if err := dev.Up(); err != nil {
+		tunDevice.Close()
+		return nil, fmt.Errorf("failed to bring up userspace WireGuard device: %w", err)
+	}
+	wg.internals.userspaceDevice = dev
+
+	// wgctrl.ConfigureDevice (called right after this from applyDeviceConfig) only knows
+	// how to reach a userspace device through its UAPI socket, exactly like the real 'wg'
+	// tool does - without this, the device comes up but can never be given a key or a peer.
+	uapi, err := startUAPIListener(dev, ifcName)
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	wg.internals.userspaceUAPI = uapi
+
+	link, err := netlink.LinkByName(ifcName)
+	if err != nil {
+		uapi.Close()
+		dev.Close()
+		return nil, fmt.Errorf("tun device %s not visible via netlink: %w", ifcName, err)
+	}
+	return link, nil
+}
+
+// stopUserspaceDevice tears down the wireguard-go device (and its UAPI listener) created by
+// startUserspaceDevice.
+func (wg *WireGuard) stopUserspaceDevice() {
+	if wg.internals.userspaceUAPI != nil {
+		wg.internals.userspaceUAPI.Close()
+		wg.internals.userspaceUAPI = nil
+	}
+	if wg.internals.userspaceDevice != nil {
+		wg.internals.userspaceDevice.Close()
+		wg.internals.userspaceDevice = nil
+	}
+}
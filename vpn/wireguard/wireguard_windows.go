@@ -0,0 +1,448 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package wireguard
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"github.com/ivpn/desktop-app-daemon/service/dns"
+	"github.com/ivpn/desktop-app-daemon/service/metrics"
+	"github.com/ivpn/desktop-app-daemon/shell"
+	"github.com/ivpn/desktop-app-daemon/vpn"
+)
+
+type operation int
+
+const (
+	disconnect operation = iota
+	resume     operation = iota
+)
+
+// keepaliveInterval - default persistent-keepalive sent to the peer so NAT/firewall
+// mappings on the client side do not expire while idle
+const keepaliveInterval = 25 * time.Second
+
+// teardownDeadline bounds how long connect() waits for deviceUp (see
+// bringUpWithDeadline). disconnect() closes the device at once; it does not wait for
+// the adapter to disappear and has no forced-destroy step.
+const teardownDeadline = 5 * time.Second
+
+// internalVariables of wireguard implementation for Windows. Unlike Linux, there is no
+// kernel WireGuard module to fall back from - the Wintun-backed userspace device (the
+// same wireguard-go core the official Windows client embeds) is the only implementation.
+type internalVariables struct {
+	manualDNS            net.IP
+	isRunning            bool
+	isPaused             bool
+	resumeDisconnectChan chan operation
+
+	wgClient   *wgctrl.Client
+	device     *device.Device
+	uapi       *uapiServer
+	listenPort int
+}
+
+// ListenPort returns the UDP port the local WireGuard interface is currently listening
+// on, which may differ from the port requested at connect time (see selectListenPort).
+func (wg *WireGuard) ListenPort() int {
+	return wg.internals.listenPort
+}
+
+func (wg *WireGuard) init() error {
+	// new connection: forget any port picked by a previous connect() on this same
+	// WireGuard instance, so selectListenPort runs fresh instead of reusing a stale value
+	wg.internals.listenPort = 0
+
+	// A Wintun adapter left behind by an unclean previous shutdown keeps the old name
+	// registered; it is disabled here (netsh admin=disabled), not deleted.
+	if ifc, err := net.InterfaceByName(wg.interfaceName()); err == nil && ifc != nil {
+		log.Info(fmt.Sprintf("Removing WireGuard adapter ('%s' expected to be stopped before the new connection)...", ifc.Name))
+		if err := shell.Exec(log, "netsh", "interface", "set", "interface", ifc.Name, "admin=disabled"); err != nil {
+			log.Warning(err)
+		}
+	}
+	return nil
+}
+
+func (wg *WireGuard) interfaceName() string {
+	name := filepath.Base(wg.configFilePath)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// connect - SYNCHRONOUSLY drive the WireGuard device (wait until it finished)
+func (wg *WireGuard) connect(stateChan chan<- vpn.StateInfo) error {
+	wg.internals.isRunning = true
+	defer func() {
+		wg.internals.isRunning = false
+	}()
+
+	wg.internals.resumeDisconnectChan = make(chan operation, 1)
+
+	for {
+		if err := wg.bringUpWithDeadline(teardownDeadline); err != nil {
+			wg.deviceDown()
+			return fmt.Errorf("failed to start WireGuard: %w", err)
+		}
+
+		err := func() error {
+			defer func() {
+				if err := dns.DeleteManual(nil); err != nil {
+					log.Warning(fmt.Sprintf("failed to restore DNS configuration: %s", err))
+				}
+			}()
+			dnsIP := wg.connectParams.hostLocalIP
+			if wg.internals.manualDNS != nil {
+				dnsIP = wg.internals.manualDNS
+			}
+			if err := dns.SetManual(dnsIP, nil); err != nil {
+				return fmt.Errorf("failed to set DNS: %w", err)
+			}
+
+			metrics.Connects.Inc()
+			stateChan <- vpn.NewStateInfoConnected(wg.connectParams.clientLocalIP, wg.connectParams.hostIP)
+
+			wg.waitWhileDeviceExists()
+			return nil
+		}()
+
+		if err != nil {
+			wg.deviceDown()
+			return err
+		}
+
+		if wg.isPaused() {
+			log.Info("Paused")
+			metrics.Pauses.Inc()
+			op := <-wg.internals.resumeDisconnectChan
+			if op != resume {
+				break
+			}
+			log.Info("Resuming...")
+			metrics.Resumes.Inc()
+			metrics.Reconnects.Inc()
+		} else {
+			break
+		}
+	}
+	return nil
+}
+
+// deviceUp creates the Wintun adapter and programs it with the private key, peer and
+// routing configuration via wgctrl/UAPI - there is no kernel-module branch on Windows.
+func (wg *WireGuard) deviceUp(cancel <-chan struct{}) (retErr error) {
+	ifcName := wg.interfaceName()
+
+	tunDevice, err := tun.CreateTUN(ifcName, device.DefaultMTU)
+	if err != nil {
+		return fmt.Errorf("failed to create Wintun adapter: %w", err)
+	}
+
+	dev := device.NewDevice(tunDevice, conn.NewDefaultBind(), device.NewLogger(device.LogLevelError, ifcName))
+	if err := dev.Up(); err != nil {
+		tunDevice.Close()
+		return fmt.Errorf("failed to bring up WireGuard device: %w", err)
+	}
+	wg.internals.device = dev
+
+	uapi, err := startUAPIListener(dev, ifcName)
+	if err != nil {
+		dev.Close()
+		return err
+	}
+	wg.internals.uapi = uapi
+
+	if isCancelled(cancel) {
+		return fmt.Errorf("WireGuard bring-up cancelled after adapter creation")
+	}
+
+	client, err := wgctrl.New()
+	if err != nil {
+		return fmt.Errorf("failed to open wgctrl client: %w", err)
+	}
+	wg.internals.wgClient = client
+
+	if err := wg.applyDeviceConfig(ifcName); err != nil {
+		return err
+	}
+
+	if isCancelled(cancel) {
+		return fmt.Errorf("WireGuard bring-up cancelled after device configuration")
+	}
+
+	addrCIDR := wg.connectParams.clientLocalIP.String() + "/32"
+	if err := shell.Exec(log, "netsh", "interface", "ip", "set", "address", ifcName, "static", addrCIDR); err != nil {
+		return fmt.Errorf("failed to assign address to %s: %w", ifcName, err)
+	}
+
+	if isCancelled(cancel) {
+		return fmt.Errorf("WireGuard bring-up cancelled after address assignment")
+	}
+
+	if err := shell.Exec(log, "netsh", "interface", "ipv4", "add", "route", "0.0.0.0/0", ifcName); err != nil {
+		return fmt.Errorf("failed to add default route via %s: %w", ifcName, err)
+	}
+
+	return nil
+}
+
+// isCancelled reports whether cancel has been closed, without blocking.
+func isCancelled(cancel <-chan struct{}) bool {
+	select {
+	case <-cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// applyDeviceConfig pushes the private key + peer (public key, endpoint, allowed IPs,
+// keepalive) to the device via wgctrl. Calling it again (e.g. for key rotation)
+// reprograms the device without tearing the tunnel down.
+func (wg *WireGuard) applyDeviceConfig(ifcName string) error {
+	privateKey, err := wgtypes.ParseKey(wg.connectParams.clientPrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to parse WG private key: %w", err)
+	}
+	publicKey, err := wgtypes.ParseKey(wg.connectParams.hostPublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to parse WG peer public key: %w", err)
+	}
+
+	_, allowedAll, _ := net.ParseCIDR("0.0.0.0/0")
+	endpoint := &net.UDPAddr{IP: wg.connectParams.hostIP, Port: wg.connectParams.hostPort}
+	keepalive := keepaliveInterval
+
+	// picked once per connect and cached on wg.internals.listenPort, see wireguard_linux.go
+	listenPort := wg.internals.listenPort
+	if listenPort == 0 {
+		listenPort, err = selectListenPort(wg.connectParams.localPort)
+		if err != nil {
+			return fmt.Errorf("failed to select WireGuard listen port: %w", err)
+		}
+		wg.internals.listenPort = listenPort
+		if listenPort != wg.connectParams.localPort {
+			log.Info(fmt.Sprintf("WireGuard listening on port %d (requested %d)", listenPort, wg.connectParams.localPort))
+		}
+	}
+
+	cfg := wgtypes.Config{
+		PrivateKey:   &privateKey,
+		ListenPort:   &listenPort,
+		ReplacePeers: true,
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:                   publicKey,
+				Endpoint:                    endpoint,
+				PersistentKeepaliveInterval: &keepalive,
+				ReplaceAllowedIPs:           true,
+				AllowedIPs:                  []net.IPNet{*allowedAll},
+			},
+		},
+	}
+
+	return wg.internals.wgClient.ConfigureDevice(ifcName, cfg)
+}
+
+// waitWhileDeviceExists blocks until the adapter disappears (forced teardown from
+// outside) or the wgClient handle is closed by disconnect()/pause().
+func (wg *WireGuard) waitWhileDeviceExists() {
+	ifcName := wg.interfaceName()
+	for {
+		time.Sleep(time.Millisecond * 500)
+		if _, err := net.InterfaceByName(ifcName); err != nil {
+			metrics.HandshakeAgeSeconds.Set(-1)
+			return
+		}
+		if wg.internals.wgClient == nil {
+			metrics.HandshakeAgeSeconds.Set(-1)
+			return
+		}
+		wg.updateHandshakeAgeMetric(ifcName)
+	}
+}
+
+func (wg *WireGuard) updateHandshakeAgeMetric(ifcName string) {
+	dev, err := wg.internals.wgClient.Device(ifcName)
+	if err != nil || len(dev.Peers) == 0 || dev.Peers[0].LastHandshakeTime.IsZero() {
+		return
+	}
+	metrics.HandshakeAgeSeconds.Set(int64(time.Since(dev.Peers[0].LastHandshakeTime).Seconds()))
+}
+
+// bringUpWithDeadline wraps deviceUp with a timeout, see wireguard_linux.go for rationale.
+func (wg *WireGuard) bringUpWithDeadline(deadline time.Duration) error {
+	cancel := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- wg.deviceUp(cancel)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(deadline):
+		close(cancel)
+		go func() {
+			if err := <-done; err == nil {
+				log.Warning("WireGuard bring-up finished after its deadline had already been reported as failed, tearing it back down")
+				wg.deviceDown()
+			}
+		}()
+		return fmt.Errorf("timed out after %s bringing up WireGuard interface", deadline)
+	}
+}
+
+func (wg *WireGuard) disconnect() error {
+	select {
+	case wg.internals.resumeDisconnectChan <- disconnect:
+	default:
+	}
+
+	metrics.Disconnects.Inc()
+
+	if wg.isPaused() {
+		wg.internals.isPaused = false
+	}
+	return wg.internalDisconnect()
+}
+
+func (wg *WireGuard) internalDisconnect() error {
+	wg.deviceDown()
+	return nil
+}
+
+// deviceDown is the unconditional, best-effort teardown used both by a clean disconnect
+// and by cleanup of a half-initialized device after a failed/cancelled bring-up.
+func (wg *WireGuard) deviceDown() {
+	if wg.internals.wgClient != nil {
+		wg.internals.wgClient.Close()
+		wg.internals.wgClient = nil
+	}
+	if wg.internals.uapi != nil {
+		wg.internals.uapi.Close()
+		wg.internals.uapi = nil
+	}
+	if wg.internals.device != nil {
+		wg.internals.device.Close()
+		wg.internals.device = nil
+	}
+}
+
+func (wg *WireGuard) isPaused() bool {
+	return wg.internals.isPaused
+}
+
+func (wg *WireGuard) pause() error {
+	if wg.internals.isRunning == false {
+		return nil
+	}
+	wg.internals.isPaused = true
+	return wg.internalDisconnect()
+}
+
+func (wg *WireGuard) resume() error {
+	if wg.internals.isPaused == false || wg.internals.isRunning == false {
+		return nil
+	}
+	wg.internals.isPaused = false
+	select {
+	case wg.internals.resumeDisconnectChan <- resume:
+	default:
+	}
+	return nil
+}
+
+func (wg *WireGuard) setManualDNS(addr net.IP) error {
+	wg.internals.manualDNS = addr
+	if wg.isPaused() || wg.internals.isRunning == false {
+		return nil
+	}
+	return dns.SetManual(addr, nil)
+}
+
+func (wg *WireGuard) resetManualDNS() error {
+	wg.internals.manualDNS = nil
+	if wg.isPaused() {
+		return nil
+	}
+	if wg.internals.isRunning {
+		return dns.SetManual(wg.connectParams.hostLocalIP, nil)
+	}
+	return dns.DeleteManual(nil)
+}
+
+// updatePeerKeys reprograms the device's private/public key pair in place, without a
+// reconnect. Used by GenerateNewKeys once a key rotation has completed.
+func (wg *WireGuard) updatePeerKeys() error {
+	if !wg.internals.isRunning || wg.internals.wgClient == nil {
+		return nil
+	}
+	metrics.KeyRotations.Inc()
+	return wg.applyDeviceConfig(wg.interfaceName())
+}
+
+// GenerateNewKeys installs a freshly rotated local private key and, if the tunnel is
+// currently up, reprograms the running device in place via updatePeerKeys instead of
+// requiring a full reconnect.
+//
+// NOTE: nothing in this checkout calls this yet. protocol/types.WireGuardGenerateNewKeys
+// is only the request's wire struct - the RPC dispatch switch that would decode it and the
+// Service type that would hold the active *WireGuard connection to call this on are both
+// outside this checkout (neither a protocol request-handler file nor a Service struct
+// exists here). Once that layer exists, its WireGuardGenerateNewKeys handler should
+// generate the new keypair, send the public half to the server, then call this method -
+// that is the one remaining step for key rotation to stop going through a full reconnect.
+func (wg *WireGuard) GenerateNewKeys(privateKey string) error {
+	wg.connectParams.clientPrivateKey = privateKey
+	return wg.updatePeerKeys()
+}
+
+func (wg *WireGuard) getOSSpecificConfigParams() (interfaceCfg []string, peerCfg []string) {
+	interfaceCfg = append(interfaceCfg, "Address = "+wg.connectParams.clientLocalIP.String()+"/32")
+	interfaceCfg = append(interfaceCfg, "SaveConfig = true")
+
+	port := wg.internals.listenPort
+	if port == 0 {
+		if selected, err := selectListenPort(wg.connectParams.localPort); err == nil {
+			wg.internals.listenPort = selected
+			port = selected
+		}
+	}
+	if port != 0 {
+		interfaceCfg = append(interfaceCfg, fmt.Sprintf("ListenPort = %d", port))
+	}
+
+	peerCfg = append(peerCfg, "AllowedIPs = 0.0.0.0/0")
+	return interfaceCfg, peerCfg
+}
@@ -0,0 +1,47 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package wifiNotifier
+
+// WiFiNetworkInfo is a single scan result, richer than a bare SSID so a client UI can
+// warn about specific insecure or spoofed (evil-twin) access points.
+type WiFiNetworkInfo struct {
+	SSID      string
+	BSSID     string // access point MAC address
+	RSSI      int    // signal strength, dBm
+	Frequency int    // MHz (e.g. 2412, 5180)
+	Security  WiFiSecurity
+	IsCurrent bool // true if this is the network we're currently associated with
+}
+
+// GetAvailableNetworksDetailed returns rich scan results for currently visible WiFi
+// networks. Implemented per-OS (netsh 'show networks mode=bssid' on Windows, CoreWLAN
+// scan on macOS, 'nmcli -t -f' on Linux).
+func GetAvailableNetworksDetailed() ([]WiFiNetworkInfo, error) {
+	return getAvailableNetworksDetailed()
+}
+
+// GetCurrentBSSID returns the MAC address of the access point we're currently
+// associated with, or "" if not connected / not supported on this platform.
+func GetCurrentBSSID() string {
+	return getCurrentBSSID()
+}
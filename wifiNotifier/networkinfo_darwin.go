@@ -0,0 +1,121 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package wifiNotifier
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// airportPath is Apple's CoreWLAN scan/diagnostic CLI. It has no replacement WLAN API
+// binding in this codebase, so it's the only way to get per-BSSID scan detail without
+// adding a CoreWLAN cgo dependency.
+const airportPath = "/System/Library/PrivateFrameworks/Apple80211.framework/Versions/Current/Resources/airport"
+
+// getAvailableNetworksDetailed runs 'airport -s', which prints one scan row per visible
+// BSSID: "SSID BSSID RSSI CHANNEL HT CC SECURITY".
+func getAvailableNetworksDetailed() ([]WiFiNetworkInfo, error) {
+	out, err := exec.Command(airportPath, "-s").Output()
+	if err != nil {
+		return nil, fmt.Errorf("airport scan failed: %w", err)
+	}
+
+	currentSSID := GetCurrentSSID()
+	var result []WiFiNetworkInfo
+	lines := strings.Split(string(out), "\n")
+	for _, line := range lines[1:] { // first line is the column header
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		info, ok := parseAirportScanLine(line)
+		if !ok {
+			continue
+		}
+		info.IsCurrent = info.SSID == currentSSID
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// getCurrentBSSID runs 'airport -I', which reports the BSSID of the network currently
+// associated with (empty/absent if not connected).
+func getCurrentBSSID() string {
+	out, err := exec.Command(airportPath, "-I").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "BSSID:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "BSSID:"))
+		}
+	}
+	return ""
+}
+
+// parseAirportScanLine parses one "SSID BSSID RSSI CHANNEL HT CC SECURITY" row. The
+// SSID itself may contain spaces, so the known-format fixed fields are peeled off the
+// end of the line and whatever remains (minus the BSSID's own surrounding whitespace)
+// is the SSID.
+func parseAirportScanLine(line string) (info WiFiNetworkInfo, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 6 {
+		return info, false
+	}
+
+	security := fields[len(fields)-1]
+	rssi, err := strconv.Atoi(fields[len(fields)-5])
+	if err != nil {
+		return info, false
+	}
+	bssid := fields[len(fields)-6]
+
+	ssidEnd := strings.LastIndex(line, bssid)
+	if ssidEnd < 0 {
+		return info, false
+	}
+	ssid := strings.TrimSpace(line[:ssidEnd])
+
+	return WiFiNetworkInfo{
+		SSID:     ssid,
+		BSSID:    bssid,
+		RSSI:     rssi,
+		Security: airportSecurityToWiFiSecurity(security),
+	}, true
+}
+
+// airportSecurityToWiFiSecurity maps airport's SECURITY column ("NONE", "WEP",
+// "WPA2(PSK/AES/AES)", ...) onto the subset of WiFiSecurity this package models today;
+// anything beyond open/WEP is left zero-valued.
+func airportSecurityToWiFiSecurity(security string) (sec WiFiSecurity) {
+	switch {
+	case strings.EqualFold(security, "NONE"):
+		return WiFiSecurityNone
+	case strings.HasPrefix(strings.ToUpper(security), "WEP"):
+		return WiFiSecurityWEP
+	default:
+		return sec
+	}
+}
@@ -0,0 +1,53 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// +build !linux,!windows,!darwin
+
+package wifiNotifier
+
+// getCurrentBSSID is the lowest-common-denominator implementation: platforms with a
+// richer native API shadow this with their own getCurrentBSSID instead.
+func getCurrentBSSID() string {
+	return ""
+}
+
+// getAvailableNetworksDetailed is the lowest-common-denominator implementation, built
+// on top of the plain SSID list every platform already provides, for platforms with no
+// richer native scan facility of their own (see networkinfo_linux.go/_windows.go/
+// _darwin.go for those) - this one leaves BSSID/RSSI/Frequency zero-valued.
+func getAvailableNetworksDetailed() ([]WiFiNetworkInfo, error) {
+	ssids := GetAvailableSSIDs()
+	currentSSID := GetCurrentSSID()
+
+	result := make([]WiFiNetworkInfo, 0, len(ssids))
+	for _, ssid := range ssids {
+		info := WiFiNetworkInfo{
+			SSID:      ssid,
+			IsCurrent: ssid == currentSSID,
+		}
+		if info.IsCurrent {
+			info.Security = GetCurrentNetworkSecurity()
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
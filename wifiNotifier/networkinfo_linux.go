@@ -0,0 +1,130 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package wifiNotifier
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// getAvailableNetworksDetailed shells out to 'nmcli' (NetworkManager's CLI, present on
+// essentially every desktop Linux distro) for a scan that carries BSSID/signal/frequency/
+// security, none of which the plain SSID list (GetAvailableSSIDs) exposes.
+func getAvailableNetworksDetailed() ([]WiFiNetworkInfo, error) {
+	out, err := exec.Command("nmcli", "-t", "-f", "SSID,BSSID,SIGNAL,FREQ,SECURITY,ACTIVE", "dev", "wifi", "list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("nmcli scan failed: %w", err)
+	}
+
+	var result []WiFiNetworkInfo
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		f := splitNmcliFields(line)
+		if len(f) < 6 {
+			continue
+		}
+		result = append(result, WiFiNetworkInfo{
+			SSID:      f[0],
+			BSSID:     f[1],
+			RSSI:      nmcliQualityToRSSI(f[2]),
+			Frequency: nmcliFreqToMHz(f[3]),
+			Security:  nmcliSecurityToWiFiSecurity(f[4]),
+			IsCurrent: f[5] == "yes",
+		})
+	}
+	return result, nil
+}
+
+// getCurrentBSSID reads the BSSID of the access point the 'active' scan row refers to.
+func getCurrentBSSID() string {
+	out, err := exec.Command("nmcli", "-t", "-f", "ACTIVE,BSSID", "dev", "wifi", "list").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		f := splitNmcliFields(line)
+		if len(f) >= 2 && f[0] == "yes" {
+			return f[1]
+		}
+	}
+	return ""
+}
+
+// splitNmcliFields splits one line of 'nmcli -t' output on ':', honouring nmcli's own
+// escaping of ':' (as '\:') inside a field - a BSSID like aa:bb:cc:dd:ee:ff would
+// otherwise be torn into six fields by a naive strings.Split.
+func splitNmcliFields(line string) []string {
+	var fields []string
+	var cur strings.Builder
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ':':
+			fields = append(fields, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	fields = append(fields, cur.String())
+	return fields
+}
+
+// nmcliQualityToRSSI converts nmcli's 0-100 signal quality to an approximate dBm value,
+// using the same linear mapping NetworkManager itself uses internally.
+func nmcliQualityToRSSI(quality string) int {
+	q, err := strconv.Atoi(quality)
+	if err != nil {
+		return 0
+	}
+	return q/2 - 100
+}
+
+// nmcliFreqToMHz parses a "2437 MHz"-style FREQ field down to its bare MHz value.
+func nmcliFreqToMHz(freq string) int {
+	mhz, _ := strconv.Atoi(strings.TrimSpace(strings.Fields(freq)[0]))
+	return mhz
+}
+
+// nmcliSecurityToWiFiSecurity maps nmcli's free-form SECURITY column ("", "WEP",
+// "WPA2", "WPA1 WPA2", ...) onto the subset of WiFiSecurity this package models today.
+// Anything beyond open/WEP is left as the zero value rather than guessed at.
+func nmcliSecurityToWiFiSecurity(security string) (sec WiFiSecurity) {
+	switch strings.TrimSpace(security) {
+	case "":
+		return WiFiSecurityNone
+	case "WEP":
+		return WiFiSecurityWEP
+	default:
+		return sec
+	}
+}
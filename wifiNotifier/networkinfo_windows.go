@@ -0,0 +1,150 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package wifiNotifier
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// getAvailableNetworksDetailed parses 'netsh wlan show networks mode=bssid', which is
+// the only built-in way to get per-BSSID signal/channel detail on Windows without a
+// native WLAN API binding.
+func getAvailableNetworksDetailed() ([]WiFiNetworkInfo, error) {
+	out, err := exec.Command("netsh", "wlan", "show", "networks", "mode=bssid").Output()
+	if err != nil {
+		return nil, fmt.Errorf("netsh wlan scan failed: %w", err)
+	}
+	result := parseNetshNetworks(string(out))
+
+	currentSSID := GetCurrentSSID()
+	for i := range result {
+		result[i].IsCurrent = result[i].SSID == currentSSID
+	}
+	return result, nil
+}
+
+// getCurrentBSSID parses 'netsh wlan show interfaces', which reports the BSSID of the
+// network the adapter is currently associated with (blank if not connected).
+func getCurrentBSSID() string {
+	out, err := exec.Command("netsh", "wlan", "show", "interfaces").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "BSSID") {
+			if _, v, ok := splitNetshKV(line); ok {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// parseNetshNetworks walks the SSID/BSSID block structure 'netsh wlan show networks
+// mode=bssid' prints: one "SSID n : name" header followed by its authentication/
+// encryption line and one or more "BSSID n : mac" sub-blocks, each with its own Signal.
+func parseNetshNetworks(output string) []WiFiNetworkInfo {
+	var result []WiFiNetworkInfo
+	var curSSID string
+	var curAuth string
+	var curBSSID string
+	var haveBSSID bool
+
+	flush := func(signal string) {
+		if !haveBSSID {
+			return
+		}
+		result = append(result, WiFiNetworkInfo{
+			SSID:      curSSID,
+			BSSID:     curBSSID,
+			RSSI:      netshSignalToRSSI(signal),
+			Security:  netshAuthToWiFiSecurity(curAuth),
+			IsCurrent: false,
+		})
+		haveBSSID = false
+	}
+
+	for _, raw := range strings.Split(output, "\n") {
+		line := strings.TrimSpace(raw)
+		key, val, ok := splitNetshKV(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(key, "SSID"):
+			flush("")
+			curSSID = val
+		case key == "Authentication":
+			curAuth = val
+		case strings.HasPrefix(key, "BSSID"):
+			flush("")
+			curBSSID = val
+			haveBSSID = true
+		case key == "Signal":
+			flush(val)
+		}
+	}
+	flush("")
+	return result
+}
+
+// splitNetshKV splits a "Key  : Value" (or "Key n : Value") netsh output line.
+func splitNetshKV(line string) (key, val string, ok bool) {
+	idx := strings.Index(line, ":")
+	if idx < 0 {
+		return "", "", false
+	}
+	key = strings.TrimSpace(line[:idx])
+	val = strings.TrimSpace(line[idx+1:])
+	if key == "" {
+		return "", "", false
+	}
+	return key, val, true
+}
+
+// netshSignalToRSSI converts netsh's "NN%" signal quality to an approximate dBm value.
+func netshSignalToRSSI(signal string) int {
+	pct := strings.TrimSuffix(strings.TrimSpace(signal), "%")
+	q, err := strconv.Atoi(pct)
+	if err != nil {
+		return 0
+	}
+	return q/2 - 100
+}
+
+// netshAuthToWiFiSecurity maps netsh's Authentication field onto the subset of
+// WiFiSecurity this package models today; anything beyond open/WEP is left zero-valued.
+func netshAuthToWiFiSecurity(auth string) (sec WiFiSecurity) {
+	switch {
+	case strings.EqualFold(auth, "Open"):
+		return WiFiSecurityNone
+	case strings.Contains(strings.ToUpper(auth), "WEP"):
+		return WiFiSecurityWEP
+	default:
+		return sec
+	}
+}
@@ -0,0 +1,169 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app-daemon
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package wifiNotifier
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// defaultPollInterval is used when StartWithFallback is called with interval <= 0
+	defaultPollInterval = 20 * time.Second
+	// pollBackoffMax caps how far the polling interval is allowed to back off to
+	// after repeated errors reading the current SSID/security
+	pollBackoffMax = 5 * time.Minute
+)
+
+// fallbackPoller periodically polls GetCurrentSSID/GetCurrentNetworkSecurity and
+// synthesizes a change callback whenever either changes since the last tick. It mirrors
+// the pattern used by netconfig watchers on platforms lacking native change signals
+// (BSDs, headless setups, or any build where the native notifier subscription failed),
+// and coexists with a native notifier: every native callback resets the poll timer so
+// the same transition isn't reported twice.
+type fallbackPoller struct {
+	mutex        sync.Mutex
+	interval     time.Duration
+	resetChan    chan struct{}
+	stopChan     chan struct{}
+	lastSSID     string
+	lastSecurity WiFiSecurity
+	haveLast     bool
+}
+
+// StartWithFallback registers 'callback' as the WiFi-change notifier (same as
+// SetWifiNotifier) and additionally arms a polling fallback that, whenever no native
+// event has been seen for 'interval' (defaultPollInterval if <= 0), re-reads the SSID/
+// security and fires the same callback if either changed. The service layer calls this instead of SetWifiNotifier and does not
+// need to know whether a given platform actually delivers native events - on
+// platforms where it does, the fallback simply never fires because every native
+// event resets its timer.
+//
+// Returns a stop function that cancels the polling goroutine.
+func StartWithFallback(callback func(ssid string), interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	p := &fallbackPoller{
+		interval:  interval,
+		resetChan: make(chan struct{}, 1),
+		stopChan:  make(chan struct{}),
+	}
+	// seed the baseline now, from the network we're already on at registration time -
+	// otherwise haveLast starts false and the very first tick always reports a
+	// "change" even though nothing actually changed since startup
+	p.lastSSID = GetCurrentSSID()
+	p.lastSecurity = GetCurrentNetworkSecurity()
+	p.haveLast = true
+
+	wrapped := func(ssid string) {
+		p.observeNativeEvent(ssid)
+		callback(ssid)
+	}
+	SetWifiNotifier(wrapped)
+
+	go p.run(callback)
+
+	return func() { close(p.stopChan) }
+}
+
+// observeNativeEvent resets the poll timer and updates the poller's baseline to the
+// network the native event just reported - without this, the baseline stays at the
+// pre-event network and pollOnce reports the same transition a second time, one
+// interval later, as a spurious duplicate callback.
+func (p *fallbackPoller) observeNativeEvent(ssid string) {
+	p.mutex.Lock()
+	p.lastSSID = ssid
+	p.lastSecurity = GetCurrentNetworkSecurity()
+	p.haveLast = true
+	p.mutex.Unlock()
+
+	select {
+	case p.resetChan <- struct{}{}:
+	default:
+	}
+}
+
+func (p *fallbackPoller) run(callback func(ssid string)) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("wifiNotifier fallback poller PANIC (recovered): ", r)
+		}
+	}()
+
+	interval := p.interval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-p.stopChan:
+			return
+
+		case <-p.resetChan:
+			// native event arrived - this transition is already handled, don't poll for it
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(interval)
+
+		case <-timer.C:
+			changed, err := p.pollOnce()
+			if err != nil {
+				log.Warning("wifiNotifier fallback poll failed: ", err)
+				interval = backoff(interval)
+			} else {
+				interval = p.interval
+				if changed {
+					callback(p.lastSSID)
+				}
+			}
+			timer.Reset(interval)
+		}
+	}
+}
+
+// pollOnce reads the current SSID/security and reports whether either changed since
+// the previous call.
+func (p *fallbackPoller) pollOnce() (changed bool, err error) {
+	ssid := GetCurrentSSID()
+	security := GetCurrentNetworkSecurity()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	changed = !p.haveLast || ssid != p.lastSSID || security != p.lastSecurity
+	p.lastSSID = ssid
+	p.lastSecurity = security
+	p.haveLast = true
+	return changed, nil
+}
+
+func backoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next > pollBackoffMax {
+		return pollBackoffMax
+	}
+	return next
+}